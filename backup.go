@@ -0,0 +1,295 @@
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Backup streams the whole DB directory into w as a tar archive. New
+// operations are blocked and in-flight writes are waited for, so the archive
+// is a consistent snapshot.
+func (d *Driver) Backup(w io.Writer) error {
+	if err := d.Flush(); err != nil {
+		return err
+	}
+
+	unlock, err := d.lockAll(false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tw := tar.NewWriter(w)
+
+	err = d.walk(d.dir, func(path string, fi os.FileInfo) error {
+		if d.isLive(path) || d.isTemp(path) {
+			return nil
+		}
+
+		if !fi.IsDir() && !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(d.dir, path)
+		if err != nil {
+			return err
+		}
+
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = filepath.ToSlash(rel)
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if fi.IsDir() {
+			return nil
+		}
+
+		b, err := d.fs.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		_, err = tw.Write(b)
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// Restore replaces the contents of the DB directory with a tar archive
+// produced by Backup, so records and collections missing from the archive
+// are gone afterwards. The archive is extracted into a hidden temp directory
+// first, leaving the database untouched if it turns out unreadable, then
+// swapped in and synced, and the indexes it holds are rebuilt from its
+// records.
+func (d *Driver) Restore(r io.Reader) error {
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	unlock, err := d.lockAll(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	staging := filepath.Join(d.dir, restoreDir+d.tempSuffix)
+
+	if err := d.removeAll(staging); err != nil {
+		return err
+	}
+
+	if err := d.extract(r, staging); err != nil {
+		d.removeAll(staging)
+		return err
+	}
+
+	d.cache.removePrefix(d.dir)
+	d.resetBloom()
+
+	if err := d.swapIn(staging); err != nil {
+		return err
+	}
+
+	return d.rebuildIndexes()
+}
+
+// restoreDir is the name, with the temp suffix added, of the directory
+// Restore extracts an archive into.
+const restoreDir = ".restore"
+
+// extract writes the entries of a Backup archive below dir, syncing every
+// directory it creates.
+func (d *Driver) extract(r io.Reader, dir string) error {
+	if err := d.fs.MkdirAll(dir, d.dirMode); err != nil {
+		return err
+	}
+
+	dirs := map[string]bool{dir: true}
+
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := filepath.FromSlash(hdr.Name)
+
+		if filepath.IsAbs(name) || strings.HasPrefix(filepath.Clean(name), "..") {
+			return fmt.Errorf("%w: archive entry '%s'", ErrInvalidName, hdr.Name)
+		}
+
+		if d.isLive(filepath.Join(d.dir, name)) {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := d.fs.MkdirAll(path, d.dirMode); err != nil {
+				return err
+			}
+
+			dirs[path] = true
+		case tar.TypeReg:
+			if err := d.fs.MkdirAll(filepath.Dir(path), d.dirMode); err != nil {
+				return err
+			}
+
+			b, err := io.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+
+			if err := d.fs.WriteFile(path, b, hdr.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+
+			dirs[filepath.Dir(path)] = true
+		}
+	}
+
+	for dir := range dirs {
+		if err := d.syncDir(dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// swapIn replaces everything in the DB directory, other than the files the
+// running Driver holds, with the contents of staging, which it removes.
+func (d *Driver) swapIn(staging string) error {
+	files, err := d.fs.ReadDir(d.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		path := filepath.Join(d.dir, file.Name())
+		if path == staging || d.isLive(path) {
+			continue
+		}
+
+		if err := d.removeAll(path); err != nil {
+			return err
+		}
+	}
+
+	files, err = d.fs.ReadDir(staging)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := d.fs.Rename(filepath.Join(staging, file.Name()), filepath.Join(d.dir, file.Name())); err != nil {
+			return err
+		}
+	}
+
+	if err := d.fs.Remove(staging); err != nil {
+		return err
+	}
+
+	return d.syncDir(d.dir)
+}
+
+// isLive reports whether path is the lock file or the WAL, which may live in
+// the DB directory but belong to the running Driver rather than its data.
+func (d *Driver) isLive(path string) bool {
+	if path == filepath.Join(d.dir, lockFile) {
+		return true
+	}
+
+	if d.wal == nil {
+		return false
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	walPath, err := filepath.Abs(d.wal.f.Name())
+
+	return err == nil && abs == walPath
+}
+
+// recoverFrom restores the archive at path if the database is empty or has
+// corrupt records, see Options.RestoreFrom.
+func (d *Driver) recoverFrom(path string) error {
+	collections, err := d.allCollections()
+	if err != nil {
+		return err
+	}
+
+	state := "is empty"
+
+	if len(collections) > 0 {
+		report, err := d.Verify()
+		if err != nil {
+			return err
+		}
+
+		n := countCorrupt(report)
+		if n == 0 {
+			return nil
+		}
+
+		state = fmt.Sprintf("has corrupt records (%d)", n)
+	}
+
+	d.log.Warn("Database '%s' %s, restoring '%s'", d.dir, state, path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("database '%s' %s and backup is unusable: %w", d.dir, state, err)
+	}
+	defer f.Close()
+
+	if err := d.Restore(f); err != nil {
+		return fmt.Errorf("database '%s' %s and restoring '%s' failed: %w", d.dir, state, path, err)
+	}
+
+	report, err := d.Verify()
+	if err != nil {
+		return err
+	}
+
+	if n := countCorrupt(report); n > 0 {
+		return fmt.Errorf("database '%s' still has corrupt records (%d) after restoring '%s'", d.dir, n, path)
+	}
+
+	return nil
+}
+
+func countCorrupt(report VerifyReport) int {
+	n := 0
+	for _, c := range report.Collections {
+		n += len(c.Corrupt)
+	}
+
+	return n
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	var archive bytes.Buffer
+	if err := d.Backup(&archive); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.DropCollection("users"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Restore(&archive); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := d.ReadAll("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := strings.Join(userNames(t, records), ","), "Mrinal,Prachi,Utkarsh"; got != want {
+		t.Fatalf("ReadAll after Restore returned %s, want %s", got, want)
+	}
+}
+
+func TestRestoreReplacesLocalRecords(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	if err := d.CreateIndex("users", "Company"); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	if err := d.Backup(&archive); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("users", "Local", User{Name: "Local", Company: "Aramco"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("scratch", "x", User{Name: "x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Restore(&archive); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := d.ReadAll("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := strings.Join(userNames(t, records), ","), "Mrinal,Prachi,Utkarsh"; got != want {
+		t.Fatalf("ReadAll after Restore returned %s, want %s", got, want)
+	}
+
+	collections, err := d.Collections()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(collections, ","); got != "users" {
+		t.Fatalf("Collections after Restore = %s, want users", got)
+	}
+
+	names, err := d.FindByIndex("users", "Company", "Aramco")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := strings.Join(names, ","), "Mrinal,Prachi"; got != want {
+		t.Fatalf("FindByIndex after Restore = %s, want %s", got, want)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), defaultTempSuffix) {
+			t.Fatalf("Restore left %s behind", file.Name())
+		}
+	}
+}
+
+func TestRestoreOfABadArchiveKeepsTheDatabase(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	var archive bytes.Buffer
+	if err := d.Backup(&archive); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cut the archive a few bytes into the last record, after the header
+	// block naming it.
+	last := bytes.Index(archive.Bytes(), []byte("users/Utkarsh.json"))
+	truncated := bytes.NewReader(archive.Bytes()[:last+512+10])
+
+	if err := d.Restore(truncated); err == nil {
+		t.Fatal("Restore of a truncated archive succeeded")
+	}
+
+	if n, err := d.Count("users"); err != nil || n != len(sampleUsers) {
+		t.Fatalf("Count after a failed Restore = %d, %v, want %d", n, err, len(sampleUsers))
+	}
+}
+
+func TestRestoreFrom(t *testing.T) {
+	src := newTestDriver(t, nil)
+
+	writeSampleUsers(t, src, "users")
+
+	archive := filepath.Join(t.TempDir(), "backup.tar")
+
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := src.Backup(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, setup := range map[string]func(dir string){
+		"Empty": func(string) {},
+		"Corrupt": func(dir string) {
+			os.MkdirAll(filepath.Join(dir, "users"), 0755)
+			os.WriteFile(filepath.Join(dir, "users", "Mrinal.json"), []byte(`{"Name": "Mri`), 0644)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			setup(dir)
+
+			d := openTestDriver(t, dir, &Options{RestoreFrom: archive})
+
+			records, err := d.ReadAll("users")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := strings.Join(userNames(t, records), ","), "Mrinal,Prachi,Utkarsh"; got != want {
+				t.Fatalf("ReadAll after New returned %s, want %s", got, want)
+			}
+		})
+	}
+
+	t.Run("Healthy", func(t *testing.T) {
+		dir := t.TempDir()
+
+		d := openTestDriver(t, dir, nil)
+		if err := d.Write("users", "Someone", User{Name: "Someone"}); err != nil {
+			t.Fatal(err)
+		}
+		d.Close()
+
+		d = openTestDriver(t, dir, &Options{RestoreFrom: archive})
+
+		records, err := d.ReadAll("users")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := strings.Join(userNames(t, records), ","), "Someone"; got != want {
+			t.Fatalf("healthy database was restored over: ReadAll returned %s, want %s", got, want)
+		}
+	})
+
+	t.Run("MissingBackup", func(t *testing.T) {
+		d, err := New(t.TempDir(), &Options{Logger: &testLogger{}, RestoreFrom: filepath.Join(t.TempDir(), "missing.tar")})
+		if err == nil {
+			d.Close()
+			t.Fatal("New of an empty database with a missing backup succeeded")
+		}
+
+		if !strings.Contains(err.Error(), "backup is unusable") {
+			t.Fatalf("New = %v, want an unusable-backup error", err)
+		}
+	})
+}
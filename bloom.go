@@ -0,0 +1,150 @@
+package main
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+const (
+	// bloomBitsPerName and bloomHashes give a false positive rate of about
+	// 1% while a filter holds no more names than it was sized for.
+	bloomBitsPerName = 10
+	bloomHashes      = 7
+
+	bloomMinNames = 1024
+)
+
+// bloomFilter is a set of resource names that can answer "definitely not
+// present" without touching disk. Names are never removed, so deleted
+// records only cost false positives, never false negatives.
+type bloomFilter struct {
+	bits     []uint64
+	names    int
+	capacity int
+}
+
+func newBloomFilter(names int) *bloomFilter {
+	capacity := 2 * names
+	if capacity < bloomMinNames {
+		capacity = bloomMinNames
+	}
+
+	return &bloomFilter{
+		bits:     make([]uint64, (capacity*bloomBitsPerName+63)/64),
+		capacity: capacity,
+	}
+}
+
+// positions derives the filter's bit positions for name by double hashing.
+func (f *bloomFilter) positions(name string, fn func(bit uint64)) {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	sum := h.Sum64()
+
+	h1, h2 := sum&0xffffffff, sum>>32|1
+	m := uint64(len(f.bits) * 64)
+
+	for i := uint64(0); i < bloomHashes; i++ {
+		fn((h1 + i*h2) % m)
+	}
+}
+
+func (f *bloomFilter) add(name string) {
+	f.positions(name, func(bit uint64) { f.bits[bit/64] |= 1 << (bit % 64) })
+	f.names++
+}
+
+func (f *bloomFilter) mayContain(name string) bool {
+	found := true
+
+	f.positions(name, func(bit uint64) {
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			found = false
+		}
+	})
+
+	return found
+}
+
+// blooms holds a bloom filter per collection, see Options.EnableBloomFilter.
+// A collection's filter is built from its directory listing on the first
+// lookup and is only read or changed under the collection's lock.
+type blooms struct {
+	enabled bool
+	mu      sync.Mutex
+	filters map[string]*bloomFilter
+}
+
+// mayContain reports whether a record might exist. false is definitive;
+// true means its file has to be checked. Callers must hold the
+// collection's lock.
+func (d *Driver) mayContain(collection, resource string) bool {
+	if !d.blooms.enabled {
+		return true
+	}
+
+	d.blooms.mu.Lock()
+	f := d.blooms.filters[collection]
+	d.blooms.mu.Unlock()
+
+	if f == nil {
+		resources, err := d.listResources(collection)
+		if err != nil {
+			return true
+		}
+
+		f = newBloomFilter(len(resources))
+		for _, r := range resources {
+			f.add(r)
+		}
+
+		d.blooms.mu.Lock()
+		if d.blooms.filters == nil {
+			d.blooms.filters = make(map[string]*bloomFilter)
+		}
+		d.blooms.filters[collection] = f
+		d.blooms.mu.Unlock()
+	}
+
+	return f.mayContain(resource)
+}
+
+// addToBloom records a newly written resource in the collection's filter,
+// if it has one. A filter that outgrew its size is dropped, to be rebuilt
+// larger on the next lookup. Callers must hold the collection's write lock.
+func (d *Driver) addToBloom(collection, resource string) {
+	if !d.blooms.enabled {
+		return
+	}
+
+	d.blooms.mu.Lock()
+	defer d.blooms.mu.Unlock()
+
+	f := d.blooms.filters[collection]
+	if f == nil {
+		return
+	}
+
+	if f.names >= f.capacity {
+		delete(d.blooms.filters, collection)
+		return
+	}
+
+	f.add(resource)
+}
+
+// resetBloom drops the filters of the given collections, or of all of them
+// if none are given, after their files changed wholesale.
+func (d *Driver) resetBloom(collections ...string) {
+	d.blooms.mu.Lock()
+	defer d.blooms.mu.Unlock()
+
+	if len(collections) == 0 {
+		d.blooms.filters = nil
+		return
+	}
+
+	for _, collection := range collections {
+		delete(d.blooms.filters, collection)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+// statCountFS is the OS filesystem, counting Stat calls.
+type statCountFS struct {
+	osFS
+	stats atomic.Int64
+}
+
+func (fs *statCountFS) Stat(name string) (os.FileInfo, error) {
+	fs.stats.Add(1)
+
+	return fs.osFS.Stat(name)
+}
+
+func writeNumbered(t testing.TB, d *Driver, collection string, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		if err := d.Write(collection, fmt.Sprint("user-", i), map[string]int{"i": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBloomFilterHasNoFalseNegatives(t *testing.T) {
+	const records = 3000
+
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, &Options{EnableBloomFilter: true})
+
+	writeNumbered(t, d, "users", records)
+
+	exists := func(d *Driver) {
+		t.Helper()
+
+		for i := 0; i < records; i++ {
+			if ok, err := d.Exists("users", fmt.Sprint("user-", i)); err != nil || !ok {
+				t.Fatalf("Exists(user-%d) = %v, %v, want true", i, ok, err)
+			}
+		}
+	}
+
+	exists(d)
+	d.Close()
+
+	// A reopened Driver builds its filter from the directory listing rather
+	// than from its own writes.
+	d = openTestDriver(t, dir, &Options{EnableBloomFilter: true})
+	exists(d)
+
+	if err := d.Delete("users", "user-7"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := d.Exists("users", "user-7"); err != nil || ok {
+		t.Fatalf("Exists of a deleted record = %v, %v, want false", ok, err)
+	}
+
+	if err := d.Write("users", "user-7", map[string]int{"i": 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := d.Exists("users", "user-7"); err != nil || !ok {
+		t.Fatalf("Exists of a rewritten record = %v, %v, want true", ok, err)
+	}
+}
+
+// BenchmarkExistsMiss looks up resources that don't exist in a collection
+// of 10000 records, reporting the Stat calls each lookup costs.
+func BenchmarkExistsMiss(b *testing.B) {
+	for _, bc := range []struct {
+		name  string
+		bloom bool
+	}{
+		{"NoBloom", false},
+		{"Bloom", true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			fs := &statCountFS{}
+			d := newTestDriver(b, &Options{FS: fs, EnableBloomFilter: bc.bloom, NoSync: true})
+
+			writeNumbered(b, d, "users", 10000)
+
+			// Build the filter before timing.
+			if _, err := d.Exists("users", "missing"); err != nil {
+				b.Fatal(err)
+			}
+
+			fs.stats.Store(0)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if ok, err := d.Exists("users", fmt.Sprint("missing-", i)); err != nil || ok {
+					b.Fatalf("Exists = %v, %v", ok, err)
+				}
+			}
+
+			b.ReportMetric(float64(fs.stats.Load())/float64(b.N), "stats/op")
+		})
+	}
+}
+
+func TestBloomFilterIgnoredWhenReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	writer := openTestDriver(t, dir, nil)
+
+	writeNumbered(t, writer, "users", 3)
+
+	reader := openTestDriver(t, dir, &Options{EnableBloomFilter: true, ReadOnly: true})
+
+	if ok, err := reader.Exists("users", "user-0"); err != nil || !ok {
+		t.Fatalf("Exists(user-0) = %v, %v, want true", ok, err)
+	}
+
+	// The writer is another process as far as the reader is concerned.
+	if err := writer.Write("users", "late", map[string]int{"i": 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := reader.Exists("users", "late"); err != nil || !ok {
+		t.Fatalf("Exists of a record written by another Driver = %v, %v, want true", ok, err)
+	}
+
+	var got map[string]int
+	if err := reader.Read("users", "late", &got); err != nil || got["i"] != 3 {
+		t.Fatalf("Read of a record written by another Driver = %v, %v", got, err)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+)
+
+// lruCache keeps the most recently read records in memory, keyed by record
+// path. A nil *lruCache is a valid, always-empty cache.
+type lruCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+	bytes int64
+
+	hits, misses uint64
+}
+
+type cacheEntry struct {
+	key   string
+	value []byte
+}
+
+func newLRUCache(size int) *lruCache {
+	if size <= 0 {
+		return nil
+	}
+
+	return &lruCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (c *lruCache) get(key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	c.hits++
+	c.ll.MoveToFront(e)
+
+	return e.Value.(*cacheEntry).value, true
+}
+
+func (c *lruCache) add(key string, value []byte) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		c.bytes += int64(len(value) - len(e.Value.(*cacheEntry).value))
+		e.Value.(*cacheEntry).value = value
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&cacheEntry{key: key, value: value})
+	c.bytes += int64(len(value))
+
+	if c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *lruCache) remove(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.removeElement(e)
+	}
+}
+
+// removePrefix drops every entry whose key starts with prefix, e.g. all
+// records of a collection directory.
+func (c *lruCache) removePrefix(prefix string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, e := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.removeElement(e)
+		}
+	}
+}
+
+func (c *lruCache) removeElement(e *list.Element) {
+	entry := e.Value.(*cacheEntry)
+
+	c.ll.Remove(e)
+	delete(c.items, entry.key)
+	c.bytes -= int64(len(entry.value))
+}
+
+// stats returns the number of cached records, their total size, and the
+// hit and miss counts of get.
+func (c *lruCache) stats() (entries int, bytes int64, hits, misses uint64) {
+	if c == nil {
+		return 0, 0, 0, 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ll.Len(), c.bytes, c.hits, c.misses
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCacheNeverServesStaleRecords(t *testing.T) {
+	d := newTestDriver(t, &Options{CacheSize: 8})
+
+	writeSampleUsers(t, d, "users")
+
+	var user User
+
+	for i := 0; i < 2; i++ {
+		if err := d.Read("users", "Mrinal", &user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, _, hits, _ := d.cache.stats(); hits == 0 {
+		t.Fatal("repeated Read didn't hit the cache")
+	}
+
+	updated := sampleUsers[0]
+	updated.Company = "Airtel"
+
+	if err := d.Write("users", "Mrinal", updated); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Read("users", "Mrinal", &user); err != nil {
+		t.Fatal(err)
+	}
+
+	if user != updated {
+		t.Fatalf("Read after Write = %+v, want %+v", user, updated)
+	}
+
+	if err := d.Delete("users", "Mrinal"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Read("users", "Mrinal", &user); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("Read after Delete = %v, want ErrRecordNotFound", err)
+	}
+
+	if err := d.Read("users", "Prachi", &user); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.DropCollection("users"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Read("users", "Prachi", &user); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("Read after DropCollection = %v, want ErrRecordNotFound", err)
+	}
+}
+
+func BenchmarkRead(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		size int
+	}{
+		{"Uncached", 0},
+		{"Cached", 8},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			d := newTestDriver(b, &Options{CacheSize: bc.size})
+
+			writeSampleUsers(b, d, "users")
+
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				var user User
+				if err := d.Read("users", "Mrinal", &user); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
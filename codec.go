@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Codec controls how records are serialized on disk and which file
+// extension they are stored under.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	Extension() string
+}
+
+// JSONCodec stores records as JSON, tab-indented unless configured
+// otherwise. It is the default Codec.
+type JSONCodec struct {
+	// Compact stores records without any indentation or trailing newline.
+	Compact bool
+
+	// Indent replaces the default tab indentation when Compact is false.
+	Indent string
+
+	// Canonical sorts the keys of every object, struct fields included, so
+	// the stored bytes don't depend on declaration or insertion order.
+	Canonical bool
+
+	// UseNumber decodes numbers into interface{} values as json.Number
+	// rather than float64, see DecodeWithNumbers.
+	UseNumber bool
+}
+
+func (c JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	if c.Canonical {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		// Decoding into interface{} turns every object into a map, which
+		// encoding/json always marshals with sorted keys.
+		var generic interface{}
+		if err := DecodeWithNumbers(b, &generic); err != nil {
+			return nil, err
+		}
+
+		v = generic
+	}
+
+	if c.Compact {
+		return json.Marshal(v)
+	}
+
+	indent := c.Indent
+	if indent == "" {
+		indent = "\t"
+	}
+
+	b, err := json.MarshalIndent(v, "", indent)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(b, byte('\n')), nil
+}
+
+func (c JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	if c.UseNumber {
+		return DecodeWithNumbers(data, v)
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func (JSONCodec) Extension() string {
+	return ".json"
+}
+
+// DecodeWithNumbers unmarshals JSON like json.Unmarshal, except that numbers
+// decoded into an interface{} become json.Number rather than float64, so
+// integers beyond 2^53 survive intact.
+func DecodeWithNumbers(raw []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("invalid character after top-level value")
+	}
+
+	return nil
+}
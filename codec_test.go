@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecodeWithNumbersKeepsLargeIntegers(t *testing.T) {
+	const id = "9007199254740993" // 2^53 + 1, not representable as a float64
+
+	var fields map[string]interface{}
+	if err := DecodeWithNumbers([]byte(`{"ID": `+id+`}`), &fields); err != nil {
+		t.Fatal(err)
+	}
+
+	n, ok := fields["ID"].(json.Number)
+	if !ok || n.String() != id {
+		t.Fatalf("ID decoded as %v (%T), want json.Number %s", fields["ID"], fields["ID"], id)
+	}
+
+	if err := DecodeWithNumbers([]byte(`{} {}`), &fields); err == nil {
+		t.Fatal("DecodeWithNumbers accepted trailing data")
+	}
+
+	d := newTestDriver(t, nil)
+
+	type account struct {
+		ID json.Number
+	}
+
+	accounts := NewCollection[account](d, "accounts")
+
+	if err := accounts.Put("big", account{ID: id}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := accounts.Get("big")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.ID.String() != id {
+		t.Fatalf("ID round-tripped as %s, want %s", got.ID, id)
+	}
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, &Options{CanonicalJSON: true})
+
+	type nameFirst struct {
+		Name string
+		Age  int
+	}
+
+	type ageFirst struct {
+		Age  int
+		Name string
+	}
+
+	for _, tc := range []struct {
+		name string
+		a, b interface{}
+	}{
+		{"structs", nameFirst{"Mrinal", 19}, ageFirst{19, "Mrinal"}},
+		{"maps", map[string]interface{}{"user": json.RawMessage(`{"Name":"Mrinal","Age":19}`)}, map[string]interface{}{"user": json.RawMessage(`{"Age":19,"Name":"Mrinal"}`)}},
+	} {
+		if err := d.Write(tc.name, "a", tc.a); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := d.Write(tc.name, "b", tc.b); err != nil {
+			t.Fatal(err)
+		}
+
+		a, err := os.ReadFile(filepath.Join(dir, tc.name, "a.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := os.ReadFile(filepath.Join(dir, tc.name, "b.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(a, b) {
+			t.Errorf("%s: files differ:\n%s\n%s", tc.name, a, b)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Collection is a typed view over a single collection of a Driver.
+type Collection[T any] struct {
+	driver *Driver
+	name   string
+}
+
+func NewCollection[T any](d *Driver, name string) *Collection[T] {
+	return &Collection[T]{driver: d, name: name}
+}
+
+func (c *Collection[T]) Get(resource string) (T, error) {
+	var v T
+
+	if _, ok := c.driver.codecFor(c.name).(JSONCodec); !ok {
+		return v, c.driver.Read(c.name, resource, &v)
+	}
+
+	var raw json.RawMessage
+
+	if err := c.driver.Read(c.name, resource, &raw); err != nil {
+		return v, err
+	}
+
+	return v, DecodeWithNumbers(raw, &v)
+}
+
+func (c *Collection[T]) Put(resource string, v T) error {
+	return c.driver.Write(c.name, resource, v)
+}
+
+func (c *Collection[T]) All() ([]T, error) {
+	records, err := c.driver.ReadAll(c.name)
+	if err != nil {
+		return nil, err
+	}
+
+	all := make([]T, 0, len(records))
+
+	for _, record := range records {
+		var v T
+
+		if err := c.driver.decode(c.name, []byte(record), &v); err != nil {
+			return nil, err
+		}
+
+		all = append(all, v)
+	}
+
+	return all, nil
+}
+
+// KeyedCollection is a typed view over a collection whose resource names are
+// derived from the records themselves by key, so a record's file always
+// matches its natural key. Unlike Collection it has no way to write a record
+// under any other name.
+type KeyedCollection[T any] struct {
+	collection *Collection[T]
+	key        func(T) string
+}
+
+func NewKeyedCollection[T any](d *Driver, name string, key func(T) string) *KeyedCollection[T] {
+	return &KeyedCollection[T]{collection: NewCollection[T](d, name), key: key}
+}
+
+// Save writes v under the resource name key(v).
+func (c *KeyedCollection[T]) Save(v T) error {
+	return c.collection.Put(c.key(v), v)
+}
+
+func (c *KeyedCollection[T]) Get(key string) (T, error) {
+	return c.collection.Get(key)
+}
+
+func (c *KeyedCollection[T]) All() ([]T, error) {
+	return c.collection.All()
+}
+
+func (c *KeyedCollection[T]) Delete(key string) error {
+	return c.collection.driver.Delete(c.collection.name, key)
+}
+
+// ReadAllInto decodes every record of a collection and appends it to the
+// slice slicePtr points to, e.g. a *[]User.
+func (d *Driver) ReadAllInto(collection string, slicePtr interface{}) error {
+	ptr := reflect.ValueOf(slicePtr)
+
+	if ptr.Kind() != reflect.Pointer || ptr.IsNil() || ptr.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("ReadAllInto: expected a non-nil pointer to a slice, got %T", slicePtr)
+	}
+
+	records, err := d.ReadAllRaw(collection)
+	if err != nil {
+		return err
+	}
+
+	slice := ptr.Elem()
+	elemType := slice.Type().Elem()
+
+	for _, record := range records {
+		elem := reflect.New(elemType)
+
+		if err := d.decode(collection, record, elem.Interface()); err != nil {
+			return err
+		}
+
+		slice = reflect.Append(slice, elem.Elem())
+	}
+
+	ptr.Elem().Set(slice)
+
+	return nil
+}
+
+// decode unmarshals a record for the typed helpers. With the default codec it
+// uses DecodeWithNumbers so large integers keep their precision.
+func (d *Driver) decode(collection string, b []byte, v interface{}) error {
+	codec := d.codecFor(collection)
+
+	if _, ok := codec.(JSONCodec); ok {
+		return DecodeWithNumbers(b, v)
+	}
+
+	return codec.Unmarshal(b, v)
+}
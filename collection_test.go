@@ -0,0 +1,78 @@
+package main
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestReadAllInto(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	users := []User{}
+	if err := d.ReadAllInto("users", &users); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+
+	want := []User{sampleUsers[0], sampleUsers[2], sampleUsers[1]}
+
+	if len(users) != len(want) {
+		t.Fatalf("ReadAllInto returned %d users, want %d", len(users), len(want))
+	}
+
+	for i := range want {
+		if users[i] != want[i] {
+			t.Fatalf("user %d = %+v, want %+v", i, users[i], want[i])
+		}
+	}
+
+	for _, bad := range []interface{}{users, &users[0], nil} {
+		if err := d.ReadAllInto("users", bad); err == nil {
+			t.Errorf("ReadAllInto(%T) succeeded", bad)
+		}
+	}
+}
+
+func TestKeyedCollection(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	users := NewKeyedCollection(d, "users", func(u User) string { return u.Name })
+
+	for _, user := range sampleUsers {
+		if err := users.Save(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range sampleUsers {
+		got, err := users.Get(want.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != want {
+			t.Fatalf("Get(%s) = %+v, want %+v", want.Name, got, want)
+		}
+
+		var raw User
+		if err := d.Read("users", want.Name, &raw); err != nil || raw != want {
+			t.Fatalf("record isn't stored under its key %s: %+v, %v", want.Name, raw, err)
+		}
+	}
+
+	if err := users.Delete("Utkarsh"); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := users.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) != 2 {
+		t.Fatalf("All returned %d users after a Delete, want 2", len(all))
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, &Options{Compress: true})
+
+	writeSampleUsers(t, d, "users")
+
+	b, err := os.ReadFile(filepath.Join(dir, "users", "Mrinal.json.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(b, []byte{0x1f, 0x8b}) {
+		t.Fatalf("record file doesn't start with the gzip magic: % x", b[:2])
+	}
+
+	for _, want := range sampleUsers {
+		var got User
+		if err := d.Read("users", want.Name, &got); err != nil {
+			t.Fatal(err)
+		}
+
+		if got != want {
+			t.Fatalf("Read = %+v, want %+v", got, want)
+		}
+	}
+
+	records, err := d.ReadAll("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != len(sampleUsers) {
+		t.Fatalf("ReadAll returned %d records, want %d", len(records), len(sampleUsers))
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+)
+
+// CollectionOptions overrides how one collection's records are stored, see
+// ConfigureCollection. Fields left unset fall back to the Driver's Options.
+type CollectionOptions struct {
+	Codec Codec
+
+	// Compress, if set, replaces Options.Compress.
+	Compress *bool
+
+	// EncryptionKey, if set, replaces Options.EncryptionKey. It must be 32
+	// bytes long.
+	EncryptionKey []byte
+}
+
+// format is how the records of a collection are stored on disk.
+type format struct {
+	codec    Codec
+	compress bool
+	aead     cipher.AEAD
+}
+
+type formats struct {
+	mu sync.RWMutex
+	m  map[string]format
+}
+
+func (f format) extension() string {
+	if f.compress {
+		return f.codec.Extension() + ".gz"
+	}
+
+	return f.codec.Extension()
+}
+
+// encode turns codec-encoded record bytes into the bytes stored on disk.
+func (f format) encode(b []byte) ([]byte, error) {
+	var err error
+
+	if f.compress {
+		if b, err = gzipBytes(b); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.aead != nil {
+		return encrypt(f.aead, b)
+	}
+
+	return b, nil
+}
+
+// decode undoes encode, returning codec-encoded record bytes.
+func (f format) decode(b []byte) ([]byte, error) {
+	var err error
+
+	if f.aead != nil {
+		if b, err = decrypt(f.aead, b); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.compress {
+		return gunzipBytes(b)
+	}
+
+	return b, nil
+}
+
+// equal reports whether records stored in f can be read back with g.
+func (f format) equal(g format) bool {
+	return f.compress == g.compress && f.aead == g.aead && reflect.DeepEqual(f.codec, g.codec)
+}
+
+// ConfigureCollection overrides the codec, compression or encryption of
+// one collection. Reads and writes of the collection use the override from
+// then on, falling back to Options for anything it leaves unset.
+//
+// Overrides are not persisted and existing records are not converted, so
+// a collection must be configured the same way, before it is used, every
+// time the database is opened.
+func (d *Driver) ConfigureCollection(collection string, opts CollectionOptions) error {
+	if collection == "" {
+		return fmt.Errorf("%w - unable to configure", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return err
+	}
+
+	if d.singleFile {
+		return fmt.Errorf("ConfigureCollection is %w", errSingleFile)
+	}
+
+	f := d.defaultFormat()
+
+	if opts.Codec != nil {
+		f.codec = opts.Codec
+	}
+
+	if opts.Compress != nil {
+		f.compress = *opts.Compress
+	}
+
+	if opts.EncryptionKey != nil {
+		aead, err := newAEAD(opts.EncryptionKey)
+		if err != nil {
+			return err
+		}
+
+		f.aead = aead
+	}
+
+	if err := d.checkTempSuffix(f); err != nil {
+		return err
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	d.formats.mu.Lock()
+	if d.formats.m == nil {
+		d.formats.m = make(map[string]format)
+	}
+	d.formats.m[collection] = f
+	d.formats.mu.Unlock()
+
+	d.cache.removePrefix(filepath.Join(d.dir, collection) + string(filepath.Separator))
+	d.resetBloom(collection)
+
+	return nil
+}
+
+// checkSameFormat rejects moving or copying record files between
+// collections that store records differently, since the files are moved
+// as they are.
+func (d *Driver) checkSameFormat(src, dst string) error {
+	if !d.format(src).equal(d.format(dst)) {
+		return fmt.Errorf("collections '%s' and '%s' are configured with different formats", src, dst)
+	}
+
+	return nil
+}
+
+func (d *Driver) defaultFormat() format {
+	return format{codec: d.codec, compress: d.compress, aead: d.aead}
+}
+
+// format returns how the collection's records are stored.
+func (d *Driver) format(collection string) format {
+	d.formats.mu.RLock()
+	defer d.formats.mu.RUnlock()
+
+	if f, ok := d.formats.m[collection]; ok {
+		return f
+	}
+
+	return d.defaultFormat()
+}
+
+// formatOf returns the format of the collection a record file belongs to.
+func (d *Driver) formatOf(path string) format {
+	rel, err := filepath.Rel(d.dir, path)
+	if err != nil {
+		return d.defaultFormat()
+	}
+
+	// The record sits directly in its collection's directory, which for a
+	// nested collection such as "users/secret" is more than one level deep.
+	return d.format(filepath.ToSlash(filepath.Dir(rel)))
+}
+
+func (d *Driver) codecFor(collection string) Codec {
+	return d.format(collection).codec
+}
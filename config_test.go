@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigureCollection(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, nil)
+
+	compress := true
+
+	if err := d.ConfigureCollection("archive", CollectionOptions{Compress: &compress}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.ConfigureCollection("users/secret", CollectionOptions{EncryptionKey: bytes.Repeat([]byte{7}, 32)}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, collection := range []string{"users", "archive", "users/secret"} {
+		writeSampleUsers(t, d, collection)
+	}
+
+	plain, err := os.ReadFile(filepath.Join(dir, "users", "Mrinal.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(plain, []byte("{")) {
+		t.Fatalf("unconfigured record isn't plain JSON: %q", plain)
+	}
+
+	compressed, err := os.ReadFile(filepath.Join(dir, "archive", "Mrinal.json.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(compressed, []byte{0x1f, 0x8b}) {
+		t.Fatalf("compressed record doesn't start with the gzip magic: % x", compressed[:2])
+	}
+
+	encrypted, err := os.ReadFile(filepath.Join(dir, "users", "secret", "Mrinal.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(encrypted, []byte("Mrinal")) {
+		t.Fatalf("record of the nested encrypted collection is plaintext: %q", encrypted)
+	}
+
+	for _, collection := range []string{"users", "archive", "users/secret"} {
+		for _, want := range sampleUsers {
+			var got User
+			if err := d.Read(collection, want.Name, &got); err != nil {
+				t.Fatalf("Read %s from '%s': %s", want.Name, collection, err)
+			}
+
+			if got != want {
+				t.Fatalf("Read from '%s' = %+v, want %+v", collection, got, want)
+			}
+		}
+	}
+}
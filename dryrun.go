@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// DryRunReport lists the records a mutating operation would change, as
+// returned by its DryRun variant, which leaves every file untouched.
+type DryRunReport struct {
+	Written []string
+	Deleted []string
+}
+
+// MigrateDryRun runs transform over a collection like Migrate, but only
+// reports which records it would rewrite or delete. Rewritten records are
+// marshalled and validated, so a record Migrate would reject fails here
+// too. It only takes the read lock and works on read-only databases.
+func (d *Driver) MigrateDryRun(collection string, transform func(raw json.RawMessage) (json.RawMessage, error)) (DryRunReport, error) {
+	if collection == "" {
+		return DryRunReport{}, fmt.Errorf("%w - unable to migrate", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return DryRunReport{}, err
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return DryRunReport{}, err
+	}
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	var report DryRunReport
+
+	_, err = d.migrate(collection, transform, &report)
+
+	return report, err
+}
+
+// DeleteWhereDryRun reports the records DeleteWhere would delete without
+// deleting them. It only takes the read lock and works on read-only
+// databases.
+func (d *Driver) DeleteWhereDryRun(collection string, predicate func(raw json.RawMessage) (bool, error)) (DryRunReport, error) {
+	if collection == "" {
+		return DryRunReport{}, fmt.Errorf("%w - unable to delete", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return DryRunReport{}, err
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return DryRunReport{}, err
+	}
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	var report DryRunReport
+
+	_, err = d.deleteWhere(collection, predicate, &report)
+
+	return report, err
+}
+
+// WriteBatchDryRun marshals and validates records like WriteBatch and
+// reports the ones it would write, without staging any of them. It takes
+// no lock, since it doesn't look at the collection.
+func (d *Driver) WriteBatchDryRun(collection string, records map[string]interface{}) (DryRunReport, error) {
+	if collection == "" {
+		return DryRunReport{}, fmt.Errorf("%w - No place to save", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return DryRunReport{}, err
+	}
+
+	resources, err := d.batchResources(records)
+	if err != nil {
+		return DryRunReport{}, err
+	}
+
+	for _, resource := range resources {
+		if _, err := d.marshalRecord(collection, records[resource]); err != nil {
+			return DryRunReport{}, err
+		}
+	}
+
+	return DryRunReport{Written: resources}, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDeleteWhereDryRun(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	report, err := d.DeleteWhereDryRun("users", func(raw json.RawMessage) (bool, error) {
+		var user User
+		if err := json.Unmarshal(raw, &user); err != nil {
+			return false, err
+		}
+
+		return user.Company == "Aramco", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(report.Deleted)
+
+	if got, want := strings.Join(report.Deleted, ","), "Mrinal,Prachi"; got != want || len(report.Written) != 0 {
+		t.Fatalf("DeleteWhereDryRun = %+v, want Deleted %s", report, want)
+	}
+
+	for _, user := range sampleUsers {
+		if _, err := os.Stat(filepath.Join(dir, "users", user.Name+".json")); err != nil {
+			t.Fatalf("dry run touched %s: %s", user.Name, err)
+		}
+	}
+}
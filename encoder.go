@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+)
+
+// ResourceEncoder maps logical resource names to the file names records are
+// stored under and back. It lets names that are unsafe on the target
+// filesystem, such as ones containing colons on Windows, be stored portably.
+// Decode must invert Encode, and Encode must return names that are valid
+// file names.
+type ResourceEncoder interface {
+	Encode(resource string) string
+	Decode(name string) (string, error)
+}
+
+// HexEncoder stores each resource under the lowercase hex encoding of its
+// name.
+type HexEncoder struct{}
+
+func (HexEncoder) Encode(resource string) string {
+	return hex.EncodeToString([]byte(resource))
+}
+
+func (HexEncoder) Decode(name string) (string, error) {
+	b, err := hex.DecodeString(name)
+	if err != nil {
+		return "", fmt.Errorf("%w: file '%s' is not hex encoded", ErrInvalidName, name)
+	}
+
+	return string(b), nil
+}
+
+// Base32Encoder stores each resource under the unpadded base32 encoding of
+// its name, which is shorter than hex and still case-insensitive.
+type Base32Encoder struct{}
+
+var base32Encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func (Base32Encoder) Encode(resource string) string {
+	return base32Encoding.EncodeToString([]byte(resource))
+}
+
+func (Base32Encoder) Decode(name string) (string, error) {
+	b, err := base32Encoding.DecodeString(name)
+	if err != nil {
+		return "", fmt.Errorf("%w: file '%s' is not base32 encoded", ErrInvalidName, name)
+	}
+
+	return string(b), nil
+}
+
+// resourceFile returns the file name, without extension, that resource is
+// stored under.
+func (d *Driver) resourceFile(resource string) string {
+	if d.encoder == nil {
+		return resource
+	}
+
+	return d.encoder.Encode(resource)
+}
+
+// resourceName recovers the logical resource name from a file name without
+// its extension.
+func (d *Driver) resourceName(name string) (string, error) {
+	if d.encoder == nil {
+		return name, nil
+	}
+
+	return d.encoder.Decode(name)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestResourceEncoders(t *testing.T) {
+	// Characters Windows doesn't allow in file names.
+	const unsafe = `<>:"|?*`
+
+	resources := []string{"10:30", "C:drive", "what?", `say "hi"`, "a|b<c>*", "ünïcödé", "plain"}
+
+	for _, tc := range []struct {
+		name    string
+		encoder ResourceEncoder
+	}{
+		{"Hex", HexEncoder{}},
+		{"Base32", Base32Encoder{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			d := openTestDriver(t, dir, &Options{ResourceEncoder: tc.encoder})
+
+			for _, resource := range resources {
+				if err := d.Write("events", resource, map[string]string{"name": resource}); err != nil {
+					t.Fatalf("Write %q: %s", resource, err)
+				}
+			}
+
+			files, err := os.ReadDir(filepath.Join(dir, "events"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, file := range files {
+				if strings.ContainsAny(file.Name(), unsafe) {
+					t.Errorf("file name %q contains characters unsafe on Windows", file.Name())
+				}
+			}
+
+			for _, resource := range resources {
+				var got map[string]string
+				if err := d.Read("events", resource, &got); err != nil || got["name"] != resource {
+					t.Fatalf("Read %q = %v, %v", resource, got, err)
+				}
+			}
+
+			records, err := d.ReadAllMap("events")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			listed := make([]string, 0, len(records))
+			for resource := range records {
+				listed = append(listed, resource)
+			}
+
+			sort.Strings(listed)
+
+			want := append([]string(nil), resources...)
+			sort.Strings(want)
+
+			if strings.Join(listed, ",") != strings.Join(want, ",") {
+				t.Fatalf("listed %q, want %q", listed, want)
+			}
+
+			for _, resource := range resources {
+				if err := d.Delete("events", resource); err != nil {
+					t.Fatalf("Delete %q: %s", resource, err)
+				}
+			}
+
+			if err := d.Read("events", "10:30", &struct{}{}); !errors.Is(err, ErrRecordNotFound) {
+				t.Fatalf("Read after Delete = %v, want ErrRecordNotFound", err)
+			}
+
+			if n, err := d.Count("events"); err != nil || n != 0 {
+				t.Fatalf("Count after deleting everything = %d, %v", n, err)
+			}
+		})
+	}
+}
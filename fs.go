@@ -0,0 +1,187 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// FS is the filesystem a Driver stores its files in, see Options.FS. Paths
+// are OS paths under the directory passed to New.
+type FS interface {
+	Stat(name string) (os.FileInfo, error)
+	MkdirAll(path string, perm os.FileMode) error
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	ReadFile(name string) ([]byte, error)
+	ReadDir(name string) ([]os.DirEntry, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+}
+
+// dirSyncer is implemented by filesystems whose directories can be fsynced.
+// On any other FS a rename is taken to be durable once it returns.
+type dirSyncer interface {
+	SyncDir(dir string) error
+}
+
+// removeAller is implemented by filesystems that can remove a tree in one
+// call; on any other FS trees are removed entry by entry.
+type removeAller interface {
+	RemoveAll(path string) error
+}
+
+// fileCreator is implemented by filesystems that can write a file as a
+// stream. WriteRaw buffers records on any other FS.
+type fileCreator interface {
+	Create(name string, perm os.FileMode) (io.WriteCloser, error)
+}
+
+// osFS is the default FS, backed by the os package. WriteFile fsyncs the
+// file before returning unless noSync is set.
+type osFS struct {
+	noSync bool
+}
+
+func (osFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
+
+func (osFS) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+
+func (osFS) ReadFile(name string) ([]byte, error) { return os.ReadFile(name) }
+
+func (osFS) ReadDir(name string) ([]os.DirEntry, error) { return os.ReadDir(name) }
+
+func (osFS) Rename(oldpath, newpath string) error { return os.Rename(oldpath, newpath) }
+
+func (osFS) Remove(name string) error { return os.Remove(name) }
+
+func (osFS) RemoveAll(path string) error { return os.RemoveAll(path) }
+
+func (fs osFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if !fs.noSync {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	return f.Close()
+}
+
+// Create opens name for writing. Closing the file fsyncs it first unless
+// noSync is set.
+func (fs osFS) Create(name string, perm os.FileMode) (io.WriteCloser, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	return syncedFile{File: f, noSync: fs.noSync}, nil
+}
+
+type syncedFile struct {
+	*os.File
+	noSync bool
+}
+
+func (f syncedFile) Close() error {
+	if !f.noSync {
+		if err := f.File.Sync(); err != nil {
+			f.File.Close()
+			return err
+		}
+	}
+
+	return f.File.Close()
+}
+
+// SyncDir fsyncs a directory so renames into it survive a crash.
+// Directories can't be synced on Windows, where this is a no-op.
+func (osFS) SyncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// removeAll removes path and everything below it. A missing path is not an
+// error, as with os.RemoveAll.
+func (d *Driver) removeAll(path string) error {
+	if fs, ok := d.fs.(removeAller); ok {
+		return fs.RemoveAll(path)
+	}
+
+	fi, err := d.fs.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if fi.IsDir() {
+		files, err := d.fs.ReadDir(path)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			if err := d.removeAll(filepath.Join(path, file.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	return d.fs.Remove(path)
+}
+
+// walk calls fn for every file and directory below dir, in lexical order,
+// with parents before their contents.
+func (d *Driver) walk(dir string, fn func(path string, fi os.FileInfo) error) error {
+	files, err := d.fs.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		path := filepath.Join(dir, file.Name())
+
+		fi, err := file.Info()
+		if err != nil {
+			return err
+		}
+
+		if err := fn(path, fi); err != nil {
+			return err
+		}
+
+		if fi.IsDir() {
+			if err := d.walk(path, fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
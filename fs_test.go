@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// memFS is an in-memory FS keyed by cleaned path. Directories are entries
+// too, so ReadDir and Rename work on trees.
+type memFS struct {
+	mu    sync.Mutex
+	files map[string]*memFile
+}
+
+type memFile struct {
+	data    []byte
+	dir     bool
+	modTime time.Time
+}
+
+func newMemFS() *memFS {
+	return &memFS{files: make(map[string]*memFile)}
+}
+
+type memFileInfo struct {
+	name string
+	f    *memFile
+}
+
+func (fi memFileInfo) Name() string       { return fi.name }
+func (fi memFileInfo) Size() int64        { return int64(len(fi.f.data)) }
+func (fi memFileInfo) ModTime() time.Time { return fi.f.modTime }
+func (fi memFileInfo) IsDir() bool        { return fi.f.dir }
+func (fi memFileInfo) Sys() interface{}   { return nil }
+
+func (fi memFileInfo) Mode() os.FileMode {
+	if fi.f.dir {
+		return fs.ModeDir | 0755
+	}
+
+	return 0644
+}
+
+func notExist(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+}
+
+func (m *memFS) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.files[name]
+	if !ok {
+		return nil, notExist("stat", name)
+	}
+
+	return memFileInfo{filepath.Base(name), f}, nil
+}
+
+func (m *memFS) MkdirAll(path string, _ os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for ; path != filepath.Dir(path); path = filepath.Dir(path) {
+		if _, ok := m.files[path]; !ok {
+			m.files[path] = &memFile{dir: true, modTime: time.Now()}
+		}
+	}
+
+	return nil
+}
+
+func (m *memFS) WriteFile(name string, data []byte, _ os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if parent, ok := m.files[filepath.Dir(name)]; !ok || !parent.dir {
+		return notExist("open", name)
+	}
+
+	m.files[name] = &memFile{data: bytes.Clone(data), modTime: time.Now()}
+
+	return nil
+}
+
+func (m *memFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.files[name]
+	if !ok || f.dir {
+		return nil, notExist("open", name)
+	}
+
+	return bytes.Clone(f.data), nil
+}
+
+func (m *memFS) ReadDir(name string) ([]os.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[name]; !ok {
+		return nil, notExist("open", name)
+	}
+
+	var entries []os.DirEntry
+
+	for path, f := range m.files {
+		if path != name && filepath.Dir(path) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(memFileInfo{filepath.Base(path), f}))
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	return entries, nil
+}
+
+func (m *memFS) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[oldpath]; !ok {
+		return notExist("rename", oldpath)
+	}
+
+	for path, f := range m.files {
+		if path == oldpath || strings.HasPrefix(path, oldpath+string(filepath.Separator)) {
+			delete(m.files, path)
+			m.files[newpath+path[len(oldpath):]] = f
+		}
+	}
+
+	return nil
+}
+
+func (m *memFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[name]; !ok {
+		return notExist("remove", name)
+	}
+
+	for path := range m.files {
+		if filepath.Dir(path) == name && path != name {
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+
+	delete(m.files, name)
+
+	return nil
+}
+
+func TestMemFS(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "db")
+	d := openTestDriver(t, dir, &Options{FS: newMemFS()})
+
+	testStore(t, d)
+
+	if err := d.Rename("users", "Mrinal", "Mrinaal"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.CopyCollection("users", "users_backup"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.DropCollection("users"); err != nil {
+		t.Fatal(err)
+	}
+
+	collections, err := d.Collections()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := strings.Join(collections, ","), "numbers,users_backup"; got != want {
+		t.Fatalf("Collections = %s, want %s", got, want)
+	}
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("the Driver touched disk: %v", err)
+	}
+}
@@ -2,4 +2,4 @@ module github.com/mrinalxdev/SturdyBeetleDB
 
 go 1.21.4
 
-require github.com/jcelliott/lumber v0.0.0-20160324203708-dd349441af25 // indirect
+require github.com/jcelliott/lumber v0.0.0-20160324203708-dd349441af25
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// groupCommit batches directory fsyncs. Every caller that asks for a sync of
+// the same directory within one interval waits for, and shares, a single
+// fsync issued at the end of that interval.
+type groupCommit struct {
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*syncBatch
+}
+
+type syncBatch struct {
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+// run performs the batch's sync, once, and wakes its waiters.
+func (b *syncBatch) run(dir string, syncFn func(string) error) {
+	b.once.Do(func() {
+		b.err = syncFn(dir)
+		close(b.done)
+	})
+}
+
+func newGroupCommit(interval time.Duration) *groupCommit {
+	return &groupCommit{interval: interval, pending: make(map[string]*syncBatch)}
+}
+
+// sync blocks until a call of syncFn(dir) that started after sync was called
+// has finished, and returns its error.
+func (g *groupCommit) sync(dir string, syncFn func(string) error) error {
+	g.mu.Lock()
+
+	b, ok := g.pending[dir]
+	if !ok {
+		b = &syncBatch{done: make(chan struct{})}
+		g.pending[dir] = b
+
+		time.AfterFunc(g.interval, func() {
+			g.mu.Lock()
+			if g.pending[dir] == b {
+				delete(g.pending, dir)
+			}
+			g.mu.Unlock()
+
+			b.run(dir, syncFn)
+		})
+	}
+
+	g.mu.Unlock()
+
+	<-b.done
+
+	return b.err
+}
+
+// flush runs every pending sync now rather than at the end of its interval
+// and waits for them to finish.
+func (g *groupCommit) flush(syncFn func(string) error) error {
+	g.mu.Lock()
+	pending := g.pending
+	g.pending = make(map[string]*syncBatch)
+	g.mu.Unlock()
+
+	var errs []error
+
+	for dir, b := range pending {
+		b.run(dir, syncFn)
+		<-b.done
+
+		if b.err != nil {
+			errs = append(errs, b.err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
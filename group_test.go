@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFlush(t *testing.T) {
+	dir := t.TempDir()
+
+	// An interval no test waits out: the writes only return once Flush
+	// commits them.
+	d := openTestDriver(t, dir, &Options{CommitInterval: time.Hour})
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for _, user := range sampleUsers {
+			if err := d.Write("users", user.Name, user); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+
+	for flushing := true; flushing; {
+		if err := d.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case <-done:
+			flushing = false
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	fresh := openTestDriver(t, dir, &Options{ReadOnly: true})
+
+	for _, user := range sampleUsers {
+		var got User
+		if err := fresh.Read("users", user.Name, &got); err != nil {
+			t.Fatal(err)
+		}
+
+		if got != user {
+			t.Fatalf("fresh Driver read %+v, want %+v", got, user)
+		}
+	}
+}
+
+// BenchmarkWriteBurst times a burst of 1000 concurrent writes to one
+// collection, fsyncing the directory after every write or once per group
+// commit.
+func BenchmarkWriteBurst(b *testing.B) {
+	const burst = 1000
+
+	for _, bc := range []struct {
+		name     string
+		interval time.Duration
+	}{
+		{"PerWrite", 0},
+		{"Grouped", 2 * time.Millisecond},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			d := newTestDriver(b, &Options{CommitInterval: bc.interval})
+
+			for i := 0; i < b.N; i++ {
+				var wg sync.WaitGroup
+
+				for j := 0; j < burst; j++ {
+					wg.Add(1)
+
+					go func(j int) {
+						defer wg.Done()
+
+						if err := d.Write("events", fmt.Sprint(j), map[string]int{"i": i, "j": j}); err != nil {
+							b.Error(err)
+						}
+					}(j)
+				}
+
+				wg.Wait()
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// indexDir holds a collection's secondary indexes, one JSON file per field.
+// Its leading dot keeps it from ever clashing with a record name.
+const indexDir = ".index"
+
+// index maps the JSON encoding of a field value to the sorted names of the
+// records holding that value.
+type index map[string][]string
+
+// CreateIndex builds an index of collection by the top-level field and keeps
+// it up to date on every later write and delete. Creating an index that
+// already exists rebuilds it.
+func (d *Driver) CreateIndex(collection, field string) error {
+	if collection == "" {
+		return fmt.Errorf("%w - unable to index", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return err
+	}
+
+	if err := d.validateName(field); err != nil {
+		return err
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	if d.singleFile {
+		return fmt.Errorf("CreateIndex is %w", errSingleFile)
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	idx, err := d.buildIndex(collection, field)
+	if err != nil {
+		return err
+	}
+
+	return d.saveIndex(collection, field, idx)
+}
+
+// FindByIndex returns the names of the records in collection whose field
+// equals value, using the index on field. A missing index is built first,
+// and saved unless the Driver is read-only.
+func (d *Driver) FindByIndex(collection, field string, value interface{}) ([]string, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("%w - unable to search", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return nil, err
+	}
+
+	if err := d.validateName(field); err != nil {
+		return nil, err
+	}
+
+	key, err := indexKey(value)
+	if err != nil {
+		return nil, err
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	mutex.RLock()
+	idx, err := d.loadIndex(collection, field)
+	mutex.RUnlock()
+
+	if os.IsNotExist(err) {
+		mutex.Lock()
+		idx, err = d.loadIndex(collection, field)
+		if os.IsNotExist(err) {
+			if idx, err = d.buildIndex(collection, field); err == nil && !d.readOnly {
+				err = d.saveIndex(collection, field, idx)
+			}
+		}
+		mutex.Unlock()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return idx[key], nil
+}
+
+// updateIndexes brings every index of collection up to date with the
+// current state of resource. Callers must hold the collection's write lock.
+// An index that cannot be updated is removed so that the next FindByIndex
+// rebuilds it.
+func (d *Driver) updateIndexes(collection, resource string) {
+	files, err := d.fs.ReadDir(filepath.Join(d.dir, collection, indexDir))
+	if err != nil {
+		return
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		field := strings.TrimSuffix(file.Name(), ".json")
+
+		if err := d.updateIndex(collection, field, resource); err != nil {
+			d.log.Warn("Dropping index '%s' of '%s': %s", field, collection, err)
+			d.fs.Remove(d.indexPath(collection, field))
+		}
+	}
+}
+
+// rebuildIndexes rebuilds every index of every collection from its records,
+// dropping those that can't be, as after Restore replaced the records under
+// them. Callers must hold every collection's write lock, as lockAll does.
+func (d *Driver) rebuildIndexes() error {
+	if d.singleFile {
+		return nil
+	}
+
+	collections, err := d.allCollections()
+	if err != nil {
+		return err
+	}
+
+	for _, collection := range collections {
+		files, err := d.fs.ReadDir(filepath.Join(d.dir, collection, indexDir))
+		if err != nil {
+			continue
+		}
+
+		for _, file := range files {
+			if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+				continue
+			}
+
+			field := strings.TrimSuffix(file.Name(), ".json")
+
+			idx, err := d.buildIndex(collection, field)
+			if err == nil {
+				err = d.saveIndex(collection, field, idx)
+			}
+
+			if err != nil {
+				d.log.Warn("Dropping index '%s' of '%s': %s", field, collection, err)
+				d.fs.Remove(d.indexPath(collection, field))
+			}
+		}
+	}
+
+	return nil
+}
+
+func (d *Driver) updateIndex(collection, field, resource string) error {
+	idx, err := d.loadIndex(collection, field)
+	if err != nil {
+		return err
+	}
+
+	for key, resources := range idx {
+		i := sort.SearchStrings(resources, resource)
+		if i == len(resources) || resources[i] != resource {
+			continue
+		}
+
+		if resources = append(resources[:i], resources[i+1:]...); len(resources) == 0 {
+			delete(idx, key)
+		} else {
+			idx[key] = resources
+		}
+	}
+
+	key, ok, err := d.fieldKey(collection, resource, field)
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		resources := idx[key]
+		i := sort.SearchStrings(resources, resource)
+		resources = append(resources, "")
+		copy(resources[i+1:], resources[i:])
+		resources[i] = resource
+		idx[key] = resources
+	}
+
+	return d.saveIndex(collection, field, idx)
+}
+
+func (d *Driver) buildIndex(collection, field string) (index, error) {
+	resources, err := d.listResources(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := make(index)
+
+	for _, resource := range resources {
+		key, ok, err := d.fieldKey(collection, resource, field)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			idx[key] = append(idx[key], resource)
+		}
+	}
+
+	return idx, nil
+}
+
+// fieldKey returns the index key of field in a record. ok is false when the
+// record does not exist, is not an object, or has no such field.
+func (d *Driver) fieldKey(collection, resource, field string) (key string, ok bool, err error) {
+	b, err := d.readRecord(d.recordPath(collection, resource))
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	var fields map[string]interface{}
+	if err := d.codecFor(collection).Unmarshal(b, &fields); err != nil {
+		return "", false, nil
+	}
+
+	value, ok := fields[field]
+	if !ok {
+		return "", false, nil
+	}
+
+	key, err = indexKey(value)
+
+	return key, err == nil, err
+}
+
+// indexKey normalises value through a JSON round trip, so that for example
+// an int and the float64 it decodes to share a key.
+func indexKey(value interface{}) (string, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return "", err
+	}
+
+	if b, err = json.Marshal(v); err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func (d *Driver) indexPath(collection, field string) string {
+	return filepath.Join(d.dir, collection, indexDir, field+".json")
+}
+
+func (d *Driver) loadIndex(collection, field string) (index, error) {
+	b, err := d.fs.ReadFile(d.indexPath(collection, field))
+	if err != nil {
+		return nil, err
+	}
+
+	idx := make(index)
+
+	return idx, json.Unmarshal(b, &idx)
+}
+
+func (d *Driver) saveIndex(collection, field string, idx index) error {
+	b, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+
+	if err := d.fs.MkdirAll(filepath.Join(d.dir, collection, indexDir), d.dirMode); err != nil {
+		return err
+	}
+
+	return d.writeFileAtomic(d.indexPath(collection, field), b)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// findByIndex returns FindByIndex's result joined with commas.
+func findByIndex(t *testing.T, d *Driver, collection, field string, value interface{}) string {
+	t.Helper()
+
+	resources, err := d.FindByIndex(collection, field, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.Join(resources, ",")
+}
+
+func TestIndexMaintenance(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	if err := d.CreateIndex("users", "Company"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := findByIndex(t, d, "users", "Company", "Aramco"); got != "Mrinal,Prachi" {
+		t.Fatalf("Aramco employees = %s, want Mrinal,Prachi", got)
+	}
+
+	moved := sampleUsers[1]
+	moved.Company = "Aramco"
+
+	if err := d.Write("users", "Utkarsh", moved); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Delete("users", "Mrinal"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := findByIndex(t, d, "users", "Company", "Aramco"); got != "Prachi,Utkarsh" {
+		t.Fatalf("Aramco employees after a write and a delete = %s, want Prachi,Utkarsh", got)
+	}
+
+	if got := findByIndex(t, d, "users", "Company", "Airtel"); got != "" {
+		t.Fatalf("Airtel employees = %s, want none", got)
+	}
+
+	// A missing index is rebuilt on lookup.
+	if err := os.RemoveAll(filepath.Join(dir, "users", indexDir)); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := findByIndex(t, d, "users", "Company", "Aramco"); got != "Prachi,Utkarsh" {
+		t.Fatalf("Aramco employees from a rebuilt index = %s, want Prachi,Utkarsh", got)
+	}
+}
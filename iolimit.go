@@ -0,0 +1,37 @@
+package main
+
+import "context"
+
+// ioLimiter is a semaphore bounding how many operations touch files at
+// once, see Options.MaxConcurrentIO. Each operation holds one slot and opens
+// its files one at a time, so n slots keep at most about n record files
+// open. A nil ioLimiter never blocks.
+type ioLimiter chan struct{}
+
+func newIOLimiter(n int) ioLimiter {
+	if n <= 0 {
+		return nil
+	}
+
+	return make(ioLimiter, n)
+}
+
+// acquire blocks until a slot is free or ctx is done.
+func (l ioLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l ioLimiter) release() {
+	if l != nil {
+		<-l
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// inflightFS is the OS filesystem, tracking the most record reads and
+// writes it ever had running at once. Each one is slowed down so that
+// unlimited callers would overlap.
+type inflightFS struct {
+	osFS
+	current atomic.Int64
+	max     atomic.Int64
+}
+
+func (fs *inflightFS) enter() {
+	n := fs.current.Add(1)
+
+	for {
+		max := fs.max.Load()
+		if n <= max || fs.max.CompareAndSwap(max, n) {
+			break
+		}
+	}
+
+	time.Sleep(time.Millisecond)
+}
+
+func (fs *inflightFS) ReadFile(name string) ([]byte, error) {
+	fs.enter()
+	defer fs.current.Add(-1)
+
+	return fs.osFS.ReadFile(name)
+}
+
+func (fs *inflightFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	fs.enter()
+	defer fs.current.Add(-1)
+
+	return fs.osFS.WriteFile(name, data, perm)
+}
+
+func TestMaxConcurrentIO(t *testing.T) {
+	const limit = 2
+
+	fs := &inflightFS{}
+	d := newTestDriver(t, &Options{FS: fs, MaxConcurrentIO: limit})
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			collection := fmt.Sprint("users-", i%10)
+			resource := fmt.Sprint("user-", i)
+
+			if err := d.Write(collection, resource, map[string]int{"i": i}); err != nil {
+				t.Error(err)
+				return
+			}
+
+			var got map[string]int
+			if err := d.Read(collection, resource, &got); err != nil || got["i"] != i {
+				t.Errorf("Read %s = %v, %v", resource, got, err)
+			}
+
+			if _, err := d.ReadAll(collection); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if max := fs.max.Load(); max > limit {
+		t.Fatalf("%d file operations ran at once, want at most %d", max, limit)
+	}
+}
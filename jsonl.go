@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ExportJSONL writes every record of a collection to w as one compact JSON
+// document per line.
+func (d *Driver) ExportJSONL(collection string, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	err := d.forEach(context.Background(), collection, func(resource string, raw []byte) error {
+		var buf bytes.Buffer
+
+		if err := json.Compact(&buf, raw); err != nil {
+			return fmt.Errorf("unable to export '%s' in '%s': %w", resource, collection, err)
+		}
+
+		buf.WriteByte('\n')
+
+		_, err := bw.Write(buf.Bytes())
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// ReadAllJSON returns every record of a collection as a single JSON array,
+// ready to be written to an HTTP response. Records are copied into it as
+// stored rather than decoded and re-encoded, so it requires the JSON codec.
+// An empty collection gives [].
+func (d *Driver) ReadAllJSON(collection string) ([]byte, error) {
+	if _, ok := d.codecFor(collection).(JSONCodec); !ok {
+		return nil, fmt.Errorf("%w: ReadAllJSON requires the JSON codec", ErrMarshal)
+	}
+
+	out := []byte{'['}
+
+	err := d.forEach(context.Background(), collection, func(resource string, raw []byte) error {
+		if len(out) > 1 {
+			out = append(out, ',')
+		}
+
+		out = append(out, bytes.TrimSpace(raw)...)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return append(out, ']'), nil
+}
+
+// ImportJSONL reads newline-delimited JSON objects from r and writes each one
+// to the collection, named after the value of its keyField. It returns the
+// number of records imported.
+func (d *Driver) ImportJSONL(collection string, r io.Reader, keyField string) (int, error) {
+	if d.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	br := bufio.NewReader(r)
+	imported := 0
+
+	for line := 1; ; line++ {
+		b, err := br.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return imported, err
+		}
+
+		if b = bytes.TrimSpace(b); len(b) > 0 {
+			resource, kerr := jsonlKey(b, keyField)
+			if kerr != nil {
+				return imported, fmt.Errorf("line %d: %w", line, kerr)
+			}
+
+			if werr := d.Write(collection, resource, json.RawMessage(b)); werr != nil {
+				return imported, fmt.Errorf("line %d: %w", line, werr)
+			}
+
+			imported++
+		}
+
+		if errors.Is(err, io.EOF) {
+			return imported, nil
+		}
+	}
+}
+
+func jsonlKey(b []byte, keyField string) (string, error) {
+	var fields map[string]json.RawMessage
+
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return "", err
+	}
+
+	raw, ok := fields[keyField]
+	if !ok {
+		return "", fmt.Errorf("missing key field '%s'", keyField)
+	}
+
+	var key string
+	if err := json.Unmarshal(raw, &key); err == nil {
+		return key, nil
+	}
+
+	return string(raw), nil
+}
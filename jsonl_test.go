@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestJSONLRoundTrip(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	var buf bytes.Buffer
+	if err := d.ExportJSONL("users", &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(sampleUsers) {
+		t.Fatalf("export has %d lines, want %d:\n%s", len(lines), len(sampleUsers), buf.String())
+	}
+
+	for _, line := range lines {
+		if strings.ContainsAny(line, "\t") {
+			t.Fatalf("exported line is not compact: %q", line)
+		}
+	}
+
+	n, err := d.ImportJSONL("imported", &buf, "Name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != len(sampleUsers) {
+		t.Fatalf("ImportJSONL imported %d records, want %d", n, len(sampleUsers))
+	}
+
+	for _, want := range sampleUsers {
+		var got User
+		if err := d.Read("imported", want.Name, &got); err != nil {
+			t.Fatal(err)
+		}
+
+		if got != want {
+			t.Fatalf("imported record = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestReadAllJSON(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	b, err := d.ReadAllJSON("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var users []User
+	if err := json.Unmarshal(b, &users); err != nil {
+		t.Fatalf("ReadAllJSON returned invalid JSON %s: %s", b, err)
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+
+	want := []User{sampleUsers[0], sampleUsers[2], sampleUsers[1]}
+	if !reflect.DeepEqual(users, want) {
+		t.Fatalf("ReadAllJSON = %+v, want %+v", users, want)
+	}
+
+	if err := d.CreateCollection("empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := d.ReadAllJSON("empty"); err != nil || string(b) != "[]" {
+		t.Fatalf("ReadAllJSON of an empty collection = %s, %v, want []", b, err)
+	}
+}
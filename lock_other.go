@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// lockDir is a no-op where flock is unavailable; AllowMultiProcess is
+// effectively always on.
+func lockDir(dir string, mode os.FileMode) (*os.File, error) {
+	return nil, nil
+}
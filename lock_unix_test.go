@@ -0,0 +1,33 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSecondNewFailsWhileLocked(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, nil)
+
+	if _, err := New(dir, &Options{Logger: &testLogger{}}); !errors.Is(err, ErrAlreadyLocked) {
+		t.Fatalf("second New = %v, want ErrAlreadyLocked", err)
+	}
+
+	shared, err := New(dir, &Options{Logger: &testLogger{}, AllowMultiProcess: true})
+	if err != nil {
+		t.Fatalf("New with AllowMultiProcess = %v", err)
+	}
+	shared.Close()
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := New(dir, &Options{Logger: &testLogger{}})
+	if err != nil {
+		t.Fatalf("New after Close = %v", err)
+	}
+	again.Close()
+}
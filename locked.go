@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+var errLockReleased = errors.New("collection lock already released")
+
+// LockedCollection accesses one collection while WithCollectionLock holds
+// its lock. Its methods take no locks of their own, so any sequence of them
+// runs without interleaving with other operations on the collection. It
+// must not be used once fn has returned.
+type LockedCollection struct {
+	driver   *Driver
+	name     string
+	write    bool
+	released bool
+}
+
+// WithCollectionLock runs fn with the collection's lock held, for writing
+// if write is set and for reading otherwise. fn must only access the
+// collection through locked: calling the Driver's own methods on the same
+// collection from fn deadlocks.
+func (d *Driver) WithCollectionLock(collection string, write bool, fn func(locked *LockedCollection) error) error {
+	if collection == "" {
+		return fmt.Errorf("%w - unable to lock", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return err
+	}
+
+	if write && d.readOnly {
+		return ErrReadOnly
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return err
+	}
+
+	if write {
+		mutex.Lock()
+		defer mutex.Unlock()
+	} else {
+		mutex.RLock()
+		defer mutex.RUnlock()
+	}
+
+	locked := &LockedCollection{driver: d, name: collection, write: write}
+	defer func() { locked.released = true }()
+
+	return fn(locked)
+}
+
+// Read decodes a record into v. Expired records are reported as
+// ErrRecordNotFound.
+func (l *LockedCollection) Read(resource string, v interface{}) error {
+	if err := l.check(resource, false); err != nil {
+		return err
+	}
+
+	d := l.driver
+	record := d.recordPath(l.name, resource)
+
+	if d.isExpired(record) {
+		return fmt.Errorf("%w: '%s' in '%s' (expired)", ErrRecordNotFound, resource, l.name)
+	}
+
+	b, ok := d.cache.get(record)
+	if !ok {
+		var err error
+		if b, err = d.readRecord(record); err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("%w: '%s' in '%s'", ErrRecordNotFound, resource, l.name)
+			}
+			return err
+		}
+
+		d.cache.add(record, b)
+	}
+
+	return d.codecFor(l.name).Unmarshal(b, v)
+}
+
+// Write stores v as a record. The lock must be held for writing.
+func (l *LockedCollection) Write(resource string, v interface{}) error {
+	if err := l.check(resource, true); err != nil {
+		return err
+	}
+
+	return l.driver.writeRecord(l.name, resource, v)
+}
+
+// Delete removes a record, returning ErrRecordNotFound if it doesn't exist.
+// The lock must be held for writing.
+func (l *LockedCollection) Delete(resource string) error {
+	if err := l.check(resource, true); err != nil {
+		return err
+	}
+
+	return l.driver.deleteRecord(l.name, resource)
+}
+
+func (l *LockedCollection) check(resource string, write bool) error {
+	if l.released {
+		return errLockReleased
+	}
+
+	if resource == "" {
+		return fmt.Errorf("%w - unable to access record (no name)", ErrEmptyResource)
+	}
+
+	if err := l.driver.validateNames(l.name, resource); err != nil {
+		return err
+	}
+
+	if write && !l.write {
+		return fmt.Errorf("%w: '%s' is locked for reading only", ErrReadOnly, l.name)
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestWithCollectionLock(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	const workers = 50
+
+	var wg sync.WaitGroup
+
+	// Each worker reads the counter and writes it back incremented, or
+	// creates it if it doesn't exist yet. Without the held lock two workers
+	// could read the same value and an increment would be lost.
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			err := d.WithCollectionLock("counters", true, func(locked *LockedCollection) error {
+				var n int
+				if err := locked.Read("visits", &n); err != nil && !errors.Is(err, ErrRecordNotFound) {
+					return err
+				}
+
+				return locked.Write("visits", n+1)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	var n int
+	if err := d.Read("counters", "visits", &n); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != workers {
+		t.Fatalf("counter = %d, want %d", n, workers)
+	}
+
+	var escaped *LockedCollection
+
+	err := d.WithCollectionLock("counters", false, func(locked *LockedCollection) error {
+		escaped = locked
+		return locked.Write("visits", 0)
+	})
+	if !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("Write under a read lock = %v, want ErrReadOnly", err)
+	}
+
+	if err := escaped.Read("visits", &n); !errors.Is(err, errLockReleased) {
+		t.Fatalf("Read after fn returned = %v, want errLockReleased", err)
+	}
+}
@@ -1,17 +1,48 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/cipher"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/jcelliott/lumber"
 )
 
 const Version = "1.0.0"
 
+var (
+	ErrEmptyCollection    = errors.New("Missing collection")
+	ErrEmptyResource      = errors.New("Missing resource")
+	ErrRecordNotFound     = errors.New("record not found")
+	ErrCollectionNotFound = errors.New("collection not found")
+	ErrInvalidName        = errors.New("invalid name")
+	ErrDecryption         = errors.New("unable to decrypt record")
+	ErrRecordExists       = errors.New("record already exists")
+	ErrClosed             = errors.New("database is closed")
+	ErrAlreadyLocked      = errors.New("database is locked by another process")
+	ErrReadOnly           = errors.New("database is read-only")
+	ErrCollectionExists   = errors.New("collection already exists")
+	ErrSchemaViolation    = errors.New("record violates collection schema")
+	ErrRecordTooLarge     = errors.New("record too large")
+	ErrEmptyRecord        = errors.New("record file is empty")
+
+	// ErrMarshal wraps codec failures to encode a value, a bug on the
+	// caller's side; ErrIO wraps failures to write to disk.
+	ErrMarshal = errors.New("unable to marshal record")
+	ErrIO      = errors.New("unable to write record")
+)
+
 type (
 	Logger interface {
 		Fatal(string, ...interface{})
@@ -23,15 +54,206 @@ type (
 	}
 
  	Driver struct {
-		mutex sync.Mutex 
-		mutexes map[string]*sync.Mutex
+		rwMutex sync.RWMutex
+		mutexes mutexTable
 		dir string
 		log Logger
+		codec Codec
+		compress bool
+		aead cipher.AEAD
+		timestamps bool
+		noSync bool
+		cache *lruCache
+		watchers watchers
+		validator func(collection string, raw []byte) error
+		fileMode os.FileMode
+		dirMode os.FileMode
+		metrics Metrics
+		closed atomic.Bool
+		stops []func()
+		wal *wal
+		lock *os.File
+		retry RetryPolicy
+		encoder ResourceEncoder
+		softDelete bool
+		group *groupCommit
+		skipIdentical bool
+		readOnly bool
+		slowThreshold time.Duration
+		schemas schemaCache
+		maxRecordBytes int64
+		tempSuffix string
+		fs FS
+		strict bool
+		formats formats
+		blooms blooms
+		singleFile bool
+		recoverTemp bool
+		ioLimit ioLimiter
 	}
 )
 
 type Options struct {
 	Logger
+	Codec Codec
+
+	// Compact, Indent and CanonicalJSON configure the default JSON codec,
+	// see JSONCodec. Records are tab-indented, with struct fields in
+	// declaration order, unless they are set. They are ignored when Codec
+	// is set.
+	Compact       bool
+	Indent        string
+	CanonicalJSON bool
+
+	// UseNumber sets UseNumber on the default JSON codec, so numbers read
+	// into interface{} values are json.Number and large integers keep their
+	// precision. It is on unless set to false; it is ignored when Codec is
+	// set.
+	UseNumber *bool
+
+	// Compress gzips records on disk, stored with a ".gz" suffix after the
+	// codec's extension.
+	Compress bool
+
+	// EncryptionKey enables AES-256-GCM encryption of records at rest. It
+	// must be 32 bytes long.
+	EncryptionKey []byte
+
+	// Timestamps wraps each record with createdAt/updatedAt metadata, see
+	// ReadMeta. The envelope is JSON, so this expects the default codec, and
+	// is tagged with a "_v" version. Turning it on needs no migration, since
+	// records without an envelope are still read as they are, but envelopes
+	// are only unwrapped while it is set, so records written with it must be
+	// read with it too.
+	Timestamps bool
+
+	// NoSync skips fsyncing record files and their directory after each
+	// write. It trades durability across power loss for lower write latency.
+	NoSync bool
+
+	// CacheSize enables an in-memory LRU cache of up to CacheSize records
+	// in front of Read.
+	CacheSize int
+
+	// Validator is called with the marshalled record before every write. A
+	// non-nil error aborts the write before anything touches disk.
+	Validator func(collection string, raw []byte) error
+
+	// FileMode and DirMode are the permissions used for record files and
+	// collection directories. They default to 0644 and 0755.
+	FileMode os.FileMode
+	DirMode  os.FileMode
+
+	// Metrics, if set, is told the duration and result of each Read,
+	// ReadAll, Delete and write, see Metrics for which operations count.
+	Metrics Metrics
+
+	// WALPath enables a write-ahead log at the given path. Writes and deletes
+	// are logged before data files are touched, and New completes any that
+	// were interrupted by a crash.
+	WALPath string
+
+	// AllowMultiProcess skips the advisory lock New takes on the .lock file
+	// in the database directory. Without the lock, other processes opening
+	// the same directory can interleave writes with this one.
+	AllowMultiProcess bool
+
+	// RetryPolicy retries transient failures of the rename that commits a
+	// write and of the remove that performs a delete. The zero value does
+	// not retry.
+	RetryPolicy RetryPolicy
+
+	// ResourceEncoder maps resource names to the file names they are stored
+	// under, see HexEncoder and Base32Encoder. The default stores each
+	// record under its own name. Changing it on an existing database hides
+	// the records written before.
+	ResourceEncoder ResourceEncoder
+
+	// SoftDelete makes deletes move records to a .trash directory inside
+	// their collection instead of removing them. See Undelete and
+	// PurgeTrash.
+	SoftDelete bool
+
+	// CommitInterval enables group commit: Write waits up to this long so
+	// that writes to the same collection arriving in the meantime share one
+	// directory fsync. Write still returns only once its record is durable.
+	// It has no effect with NoSync.
+	CommitInterval time.Duration
+
+	// SkipIdenticalWrites makes a write whose marshalled record matches the
+	// stored one a no-op, leaving the file and its mtime untouched. A write
+	// over a record with a TTL is never skipped, since it clears the TTL.
+	SkipIdenticalWrites bool
+
+	// ReadOnly opens an existing database for reading only. Every method
+	// that would modify it returns ErrReadOnly instead, expired records are
+	// hidden but never deleted, and New neither creates the directory, takes
+	// the advisory lock nor replays the WAL.
+	ReadOnly bool
+
+	// SlowThreshold, if set, logs a warning for every operation reported to
+	// Metrics that takes longer.
+	SlowThreshold time.Duration
+
+	// MaxRecordBytes rejects writes whose marshalled record is larger, with
+	// ErrRecordTooLarge, before anything touches disk. Zero means no limit.
+	MaxRecordBytes int64
+
+	// TempSuffix names the temp file a record is written to before being
+	// renamed into place, defaulting to ".temp". It is appended to the
+	// record's path, so the temp file always sits in the record's directory
+	// and the rename stays atomic; a suffix containing a path separator is
+	// rejected.
+	TempSuffix string
+
+	// FS replaces the OS filesystem the database directory lives on, for
+	// example with an in-memory one in tests. Directories are only fsynced
+	// if it has a SyncDir(dir string) error method. The advisory lock is not
+	// taken on a custom FS, and the WAL at WALPath always uses the OS.
+	FS FS
+
+	// StrictCollections stops writes from creating collections implicitly:
+	// writing to a collection that doesn't exist fails with
+	// ErrCollectionNotFound until it is made with CreateCollection, so a
+	// misspelled name is caught instead of silently starting a new one.
+	StrictCollections bool
+
+	// RestoreFrom is the path of an archive written by Backup. If the
+	// database turns out empty or to have records that fail Verify when New
+	// opens it, the archive replaces its contents before New returns. The
+	// check only knows the formats set here, not ConfigureCollection's.
+	RestoreFrom string
+
+	// EnableBloomFilter keeps an in-memory bloom filter of each collection's
+	// resource names, built on its first lookup, so Exists and Read can
+	// report a missing record without touching disk. Records created behind
+	// the Driver's back are missed until the filter is rebuilt, so it is
+	// ignored with AllowMultiProcess and with ReadOnly, which both let
+	// another process write to the directory.
+	EnableBloomFilter bool
+
+	// SingleFile stores each collection as one "<collection>.json" file
+	// holding an object keyed by resource, instead of a directory with a
+	// file per record. Every write or delete rewrites the collection's file
+	// through a temp file and rename, so it suits small collections. It
+	// requires the JSON codec and can't be combined with Compress,
+	// EncryptionKey, Timestamps, SoftDelete, WALPath or StrictCollections;
+	// ConfigureCollection, Transaction, WriteWithTTL and CreateIndex are not
+	// supported.
+	SingleFile bool
+
+	// RecoverTempFiles has a read of a missing record look for the temp file
+	// of a write that crashed before its rename. If it holds a record that
+	// decodes, the rename is completed under the write lock and the record
+	// returned, recovering the write. It costs a stat of the temp file on
+	// every read and is ignored with ReadOnly.
+	RecoverTempFiles bool
+
+	// MaxConcurrentIO bounds how many Write, Read and ReadAll calls touch
+	// files at the same time; further calls wait for one to finish, or for
+	// their context to be done, instead of failing once the process runs
+	// out of file descriptors. Zero means no limit.
+	MaxConcurrentIO int
 }
 
 func New(dir string, options *Options)(*Driver, error){
@@ -44,137 +266,1837 @@ func New(dir string, options *Options)(*Driver, error){
 		opts = *options
 	}
 
-	if opts.Logger != nil {
+	if opts.Logger == nil {
 		opts.Logger = lumber.NewConsoleLogger((lumber.INFO))
 	}
 
+	if opts.Codec == nil {
+		opts.Codec = JSONCodec{
+			Compact:   opts.Compact,
+			Indent:    opts.Indent,
+			Canonical: opts.CanonicalJSON,
+			UseNumber: opts.UseNumber == nil || *opts.UseNumber,
+		}
+	}
+
+	if opts.Metrics == nil {
+		opts.Metrics = noopMetrics{}
+	}
+
+	if opts.SingleFile {
+		if err := checkSingleFile(opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.FileMode == 0 {
+		opts.FileMode = 0644
+	}
+
+	if opts.DirMode == 0 {
+		opts.DirMode = 0755
+	}
+
+	if opts.TempSuffix == "" {
+		opts.TempSuffix = defaultTempSuffix
+	}
+
+	fs := opts.FS
+	if fs == nil {
+		fs = osFS{noSync: opts.NoSync}
+	}
+
+	var aead cipher.AEAD
+
+	if opts.EncryptionKey != nil {
+		var err error
+		if aead, err = newAEAD(opts.EncryptionKey); err != nil {
+			return nil, err
+		}
+	}
+
 	driver := Driver{
 		dir: dir, 
-		mutexes: make(map[string]*sync.Mutex),
 		log : opts.Logger,
+		codec: opts.Codec,
+		compress: opts.Compress,
+		aead: aead,
+		timestamps: opts.Timestamps,
+		noSync: opts.NoSync,
+		cache: newLRUCache(opts.CacheSize),
+		validator: opts.Validator,
+		fileMode: opts.FileMode,
+		dirMode: opts.DirMode,
+		metrics: opts.Metrics,
+		retry: opts.RetryPolicy,
+		encoder: opts.ResourceEncoder,
+		softDelete: opts.SoftDelete,
+		skipIdentical: opts.SkipIdenticalWrites,
+		readOnly: opts.ReadOnly,
+		slowThreshold: opts.SlowThreshold,
+		maxRecordBytes: opts.MaxRecordBytes,
+		tempSuffix: opts.TempSuffix,
+		fs: fs,
+		strict: opts.StrictCollections,
+		blooms: blooms{enabled: opts.EnableBloomFilter && !opts.AllowMultiProcess && !opts.ReadOnly},
+		singleFile: opts.SingleFile,
+		recoverTemp: opts.RecoverTempFiles && !opts.ReadOnly,
+		ioLimit: newIOLimiter(opts.MaxConcurrentIO),
 	}
 
-	if _, err := os.Stat(dir); err == nil {
+	if err := driver.checkTempSuffix(driver.defaultFormat()); err != nil {
+		return nil, err
+	}
+
+	if opts.CommitInterval > 0 && !opts.NoSync {
+		driver.group = newGroupCommit(opts.CommitInterval)
+	}
+
+	if fi, err := driver.fs.Stat(dir); err == nil {
+		if !fi.IsDir() {
+			return nil, fmt.Errorf("path %q exists and is not a directory", dir)
+		}
+
 		opts.Logger.Debug("Using '%s' (database already exists)\n", dir)
+	} else if opts.ReadOnly {
+		return nil, err
+	} else {
+		opts.Logger.Debug("Creating the Base at '%s' ....", dir)
 
+		if err := driver.fs.MkdirAll(dir, opts.DirMode); err != nil {
+			return &driver, err
+		}
+	}
+
+	if opts.ReadOnly {
 		return &driver, nil
 	}
 
-	opts.Logger.Debug("Creating the Base at '%s' ....", dir)
+	if !opts.AllowMultiProcess && opts.FS == nil {
+		lock, err := lockDir(dir, opts.FileMode)
+		if err != nil {
+			return nil, err
+		}
+
+		driver.lock = lock
+	}
+
+	if opts.WALPath != "" {
+		w, err := openWAL(opts.WALPath, opts.FileMode, opts.NoSync)
+		if err != nil {
+			driver.unlockDir()
+			return nil, err
+		}
+
+		driver.wal = w
+
+		if err := driver.replayWAL(); err != nil {
+			w.close()
+			driver.unlockDir()
+			return nil, err
+		}
+	}
+
+	if opts.RestoreFrom != "" {
+		if err := driver.recoverFrom(opts.RestoreFrom); err != nil {
+			driver.Close()
+			return nil, err
+		}
+	}
+
+	return &driver, nil
+}
 
-	return &driver, os.MkdirAll(dir, 0755)
+func (d *Driver) Write(collection, resource string, v interface{}) error {
+	return d.WriteContext(context.Background(), collection, resource, v)
 }
 
-func (d* Driver) Write(collection, resource string, v interface{}) error {
+func (d *Driver) WriteContext(ctx context.Context, collection, resource string, v interface{}) (err error) {
+	defer d.observe(d.metrics.ObserveWrite, "Write", collection, time.Now(), &err)
+
 	if collection == ""{
-		return fmt.Errorf("Missing collection - No place to save")
+		return fmt.Errorf("%w - No place to save", ErrEmptyCollection)
 	}
 
 	if resource == "" {
-		return fmt.Errorf("Missing resources - unable to save record (no name)")
+		return fmt.Errorf("%w - unable to save record (no name)", ErrEmptyResource)
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
 	}
 
-	mutex := d.getOrCreateMutex(collection)
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return err
+	}
+
+	if err := d.ioLimit.acquire(ctx); err != nil {
+		return err
+	}
+	defer d.ioLimit.release()
+
 	mutex.Lock()
 
+	if d.group == nil {
+		defer mutex.Unlock()
+		return d.writeRecord(collection, resource, v)
+	}
+
+	err = d.putRecord(collection, resource, v)
+	mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return ioError(d.group.sync(d.recordDir(collection), d.syncDir))
+}
+
+// Update runs a read-modify-write cycle on a record while holding the
+// collection's write lock. fn receives the current bytes, or nil if the
+// record does not exist yet, and returns the value to store.
+func (d *Driver) Update(collection, resource string, fn func(raw []byte) (interface{}, error)) (err error) {
+	defer d.observe(d.metrics.ObserveWrite, "Update", collection, time.Now(), &err)
+
+	if collection == "" {
+		return fmt.Errorf("%w - unable to update record", ErrEmptyCollection)
+	}
+
+	if resource == "" {
+		return fmt.Errorf("%w - unable to update record (no name)", ErrEmptyResource)
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return err
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
 	defer mutex.Unlock()
 
-	dir := filepath.Join(d.dir, collection)
+	raw, err := d.readRecord(d.recordPath(collection, resource))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		raw = nil
+	}
+
+	v, err := fn(raw)
+	if err != nil {
+		return err
+	}
+
+	return d.writeRecord(collection, resource, v)
+}
+
+// GetOrCreate reads a record into v, or, if it doesn't exist, stores the
+// value returned by create and decodes that into v. The collection's write
+// lock is held throughout, so concurrent callers see exactly one create.
+func (d *Driver) GetOrCreate(collection, resource string, v interface{}, create func() (interface{}, error)) error {
+	if collection == "" {
+		return fmt.Errorf("%w - unable to read record", ErrEmptyCollection)
+	}
+
+	if resource == "" {
+		return fmt.Errorf("%w - unable to read record (no name)", ErrEmptyResource)
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return err
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return err
+	}
 
-	fnlPath := filepath.Join(dir, resource + ".json")
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	b, err := d.readRecord(d.recordPath(collection, resource))
+	if err == nil {
+		return d.codecFor(collection).Unmarshal(b, v)
+	}
 
-	tmpPath := fnlPath + ".temp"
+	if !os.IsNotExist(err) {
+		return err
+	}
 
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err 
+	if d.readOnly {
+		return ErrReadOnly
 	}
 
-	b, err := json.MarshalIndent(v, "", "\t")
+	created, err := create()
 	if err != nil {
 		return err
 	}
 
-	b = append(b, byte('\n'))
+	if err := d.writeRecord(collection, resource, created); err != nil {
+		return err
+	}
 
-	if err := os.WriteFile(tmpPath, b, 0644) ; err != nil {
+	if b, err = d.codecFor(collection).Marshal(created); err != nil {
 		return err
-	} 
+	}
 
-	return os.Rename(tmpPath, fnlPath)
+	return d.codecFor(collection).Unmarshal(b, v)
 }
 
-func (d *Driver) Read(collection , resource string, v interface{}) error {
+// CompareAndSwap replaces a record with replacement only if its current
+// content equals expected, ignoring formatting whitespace. It reports whether
+// the swap happened.
+func (d *Driver) CompareAndSwap(collection, resource string, expected, replacement interface{}) (bool, error) {
 	if collection == "" {
-		return fmt.Errorf("Missing collection - no place to save ")
+		return false, fmt.Errorf("%w - No place to save", ErrEmptyCollection)
 	}
 
 	if resource == "" {
-		return fmt.Errorf("Missing collection - no collection to save")
+		return false, fmt.Errorf("%w - unable to save record (no name)", ErrEmptyResource)
 	}
-	record := filepath.Join(d.dir , resource)
 
-	if _, err := stat(record); err != nil {
-		return nil
+	if err := d.validateNames(collection, resource); err != nil {
+		return false, err
+	}
+
+	want, err := d.codecFor(collection).Marshal(expected)
+	if err != nil {
+		return false, err
+	}
+
+	if d.readOnly {
+		return false, ErrReadOnly
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return false, err
 	}
 
-	b, err := os.ReadFile(record + ".json")
+	mutex.Lock()
+	defer mutex.Unlock()
 
+	current, err := d.readRecord(d.recordPath(collection, resource))
 	if err != nil {
-		return err 
+		if os.IsNotExist(err) {
+			return false, fmt.Errorf("%w: '%s' in '%s'", ErrRecordNotFound, resource, collection)
+		}
+		return false, err
+	}
+
+	if !bytes.Equal(normalize(current), normalize(want)) {
+		return false, nil
+	}
+
+	if err := d.writeRecord(collection, resource, replacement); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// normalize strips insignificant whitespace from JSON so that differently
+// indented encodings of the same value compare equal. Non-JSON input is
+// returned unchanged.
+func normalize(b []byte) []byte {
+	var buf bytes.Buffer
+
+	if err := json.Compact(&buf, b); err != nil {
+		return b
 	}
 
-	return json.Unmarshal(b, &v)
+	return buf.Bytes()
 }
 
-func (d *Driver) ReadAll(collection string)([]string, error) {
+// WriteBatch writes several records of one collection under a single write
+// lock. Every record is marshalled and staged to a temp file before any of
+// them is renamed into place, so a marshal failure leaves the collection
+// untouched.
+// The rename phase is only atomic per file: a failure part way through can
+// leave some records updated and others not.
+func (d *Driver) WriteBatch(collection string, records map[string]interface{}) (err error) {
+	defer d.observe(d.metrics.ObserveWrite, "WriteBatch", collection, time.Now(), &err)
+
 	if collection == "" {
-		return nil, fmt.Errorf("Missing Collection - unable to read")
+		return fmt.Errorf("%w - No place to save", ErrEmptyCollection)
 	}
 
-	dir := filepath.Join(d.dir, collection)
+	if err := d.validateNames(collection); err != nil {
+		return err
+	}
 
-	if _, err := stat(dir); err != nil {
-		return nil, err
+	resources, err := d.batchResources(records)
+	if err != nil {
+		return err
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return err
 	}
 
-	files, _ := os.ReadDir(dir)
+	mutex.Lock()
+	defer mutex.Unlock()
 
-	var records []string 
+	if err := d.checkCollection(collection); err != nil {
+		return err
+	}
 
-	for _, file := range files {
-		b, err := os.ReadFile(filepath.Join(dir, file.Name()))
+	if d.singleFile {
+		data := make(map[string][]byte, len(resources))
+
+		for _, resource := range resources {
+			b, err := d.marshalRecord(collection, records[resource])
+			if err != nil {
+				return err
+			}
+
+			data[resource] = b
+		}
+
+		if err := d.storeSingle(collection, data); err != nil {
+			return err
+		}
+
+		return ioError(d.syncDir(d.recordDir(collection)))
+	}
+
+	type stagedRecord struct {
+		resource, tmpPath, fnlPath string
+		data                       []byte
+	}
+
+	staged := make([]stagedRecord, 0, len(resources))
+	entries := make([]walEntry, 0, len(resources))
+
+	for _, resource := range resources {
+		fnlPath := d.recordPath(collection, resource)
+
+		b, err := d.encodeRecord(collection, fnlPath, records[resource])
+		if err != nil {
+			return err
+		}
+
+		staged = append(staged, stagedRecord{resource: resource, fnlPath: fnlPath, data: b})
+		entries = append(entries, walEntry{Op: walWrite, Collection: collection, Resource: resource, Hash: walHash(b)})
+	}
 
+	id, err := d.wal.begin(entries...)
+	if err != nil {
+		return err
+	}
+	defer d.wal.end(id)
+
+	for i := range staged {
+		tmpPath, err := d.stageRecord(collection, staged[i].fnlPath, staged[i].data)
 		if err != nil {
+			for _, r := range staged[:i] {
+				d.fs.Remove(r.tmpPath)
+			}
+			return ioError(err)
+		}
+
+		staged[i].tmpPath = tmpPath
+	}
+
+	for _, r := range staged {
+		if err := d.commitRecord(r.tmpPath, r.fnlPath); err != nil {
+			return ioError(err)
+		}
+
+		d.updateIndexes(collection, r.resource)
+		d.addToBloom(collection, r.resource)
+		d.publish(OpWrite, collection, r.resource)
+	}
+
+	return ioError(d.syncDir(filepath.Join(d.dir, collection)))
+}
+
+// batchResources validates the resource names of a WriteBatch and returns
+// them sorted.
+func (d *Driver) batchResources(records map[string]interface{}) ([]string, error) {
+	resources := make([]string, 0, len(records))
+
+	for resource := range records {
+		if resource == "" {
+			return nil, fmt.Errorf("%w - unable to save record (no name)", ErrEmptyResource)
+		}
+
+		if err := d.validateResource(resource); err != nil {
 			return nil, err
 		}
 
-		records = append(records, string(b))
+		resources = append(resources, resource)
+	}
+
+	sort.Strings(resources)
+
+	return resources, nil
+}
+
+func (d *Driver) writeRecord(collection, resource string, v interface{}) error {
+	if err := d.putRecord(collection, resource, v); err != nil {
+		return err
+	}
+
+	return ioError(d.syncDir(d.recordDir(collection)))
+}
+
+// putRecord is writeRecord without the final directory sync, which group
+// commit defers until the collection lock has been released.
+func (d *Driver) putRecord(collection, resource string, v interface{}) error {
+	if err := d.checkCollection(collection); err != nil {
+		return err
+	}
+
+	data, err := d.marshalRecord(collection, v)
+	if err != nil {
+		return err
 	}
 
-	return records, nil
+	return d.storeRecord(collection, resource, data)
 }
 
+// storeRecord writes marshalled, validated record bytes. Callers must hold
+// the collection's write lock.
+func (d *Driver) storeRecord(collection, resource string, data []byte) error {
+	if d.singleFile {
+		return d.storeSingle(collection, map[string][]byte{resource: data})
+	}
 
+	fnlPath := d.recordPath(collection, resource)
 
-func (d *Driver) getOrCreateMutex(collection string) *sync.Mutex {
+	if d.skipIdentical && d.isUnchanged(fnlPath, data) {
+		return nil
+	}
 
-	d.mutex.Lock()
-	defer d.mutex.Unlock()
-	m, ok := d.mutexes[collection]
+	b, err := d.sealRecord(fnlPath, data)
+	if err != nil {
+		return err
+	}
 
-	if !ok {
-		m = &sync.Mutex{}
-		d.mutexes[collection] = m
+	id, err := d.wal.begin(walEntry{Op: walWrite, Collection: collection, Resource: resource, Hash: walHash(b)})
+	if err != nil {
+		return ioError(err)
 	}
+	defer d.wal.end(id)
 
-	return m
+	tmpPath, err := d.stageRecord(collection, fnlPath, b)
+	if err != nil {
+		return ioError(err)
+	}
+
+	if err := d.commitRecord(tmpPath, fnlPath); err != nil {
+		return ioError(err)
+	}
+
+	d.updateIndexes(collection, resource)
+	d.addToBloom(collection, resource)
+	d.publish(OpWrite, collection, resource)
+
+	return nil
+}
+
+// commitRecord moves a staged record into place. A plain write replaces any
+// expiry set by an earlier WriteWithTTL.
+func (d *Driver) commitRecord(tmpPath, fnlPath string) error {
+	d.cache.remove(fnlPath)
+
+	if err := d.retry.do(func() error { return d.fs.Rename(tmpPath, fnlPath) }); err != nil {
+		return err
+	}
+
+	return d.clearExpiry(fnlPath)
+}
+
+// checkCollection returns ErrCollectionNotFound if StrictCollections is set
+// and the collection hasn't been created yet. Callers must hold the
+// collection's lock.
+func (d *Driver) checkCollection(collection string) error {
+	if !d.strict {
+		return nil
+	}
+
+	if _, err := d.fs.Stat(filepath.Join(d.dir, collection)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: '%s'", ErrCollectionNotFound, collection)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ioError wraps a failure to write a record in ErrIO, keeping the cause
+// available to errors.Is and errors.As.
+func ioError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %w", ErrIO, err)
 }
 
-func stat(path string)(fi os.FileInfo, err error){
-	if fi, err = os.Stat(path); os.IsNotExist(err){
-		fi, err = os.Stat(path + ".json")
+// encodeRecord marshals and validates v and returns the bytes to store at
+// fnlPath.
+func (d *Driver) encodeRecord(collection, fnlPath string, v interface{}) ([]byte, error) {
+	b, err := d.marshalRecord(collection, v)
+	if err != nil {
+		return nil, err
 	}
-	return 
+
+	return d.sealRecord(fnlPath, b)
+}
+
+// marshalRecord marshals v with the codec and runs the validator on it.
+func (d *Driver) marshalRecord(collection string, v interface{}) ([]byte, error) {
+	b, err := d.codecFor(collection).Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMarshal, err)
+	}
+
+	if err := d.checkRecordBytes(collection, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// checkRecordBytes applies MaxRecordBytes, the validator and the schema to
+// marshalled record bytes.
+func (d *Driver) checkRecordBytes(collection string, b []byte) error {
+	if d.maxRecordBytes > 0 && int64(len(b)) > d.maxRecordBytes {
+		return fmt.Errorf("%w: %d bytes in '%s', limit is %d", ErrRecordTooLarge, len(b), collection, d.maxRecordBytes)
+	}
+
+	if d.validator != nil {
+		if err := d.validator(collection, b); err != nil {
+			return err
+		}
+	}
+
+	return d.checkSchema(collection, b)
+}
+
+// sealRecord wraps marshalled record bytes in their timestamp envelope, if
+// enabled, and compresses and encrypts them for storage at fnlPath.
+func (d *Driver) sealRecord(fnlPath string, b []byte) (_ []byte, err error) {
+	f := d.formatOf(fnlPath)
+
+	if d.timestamps {
+		if b, err = f.codec.Marshal(d.stamp(fnlPath, json.RawMessage(b))); err != nil {
+			return nil, err
+		}
+	}
+
+	return f.encode(b)
+}
+
+// isUnchanged reports whether the record stored at fnlPath holds exactly the
+// marshalled bytes b and has no expiry that writing it would clear.
+func (d *Driver) isUnchanged(fnlPath string, b []byte) bool {
+	if _, err := d.fs.Stat(d.expiryPath(fnlPath)); !os.IsNotExist(err) {
+		return false
+	}
+
+	current, err := d.readRecord(fnlPath)
+	if err != nil {
+		return false
+	}
+
+	if d.timestamps {
+		// The envelope re-indents the record, so compare it compacted.
+		return bytes.Equal(normalize(current), normalize(b))
+	}
+
+	return bytes.Equal(current, b)
+}
+
+// stageRecord writes encoded record bytes to a temp file next to fnlPath and
+// returns the temp file's path.
+func (d *Driver) stageRecord(collection, fnlPath string, b []byte) (string, error) {
+	tmpPath := fnlPath + d.tempSuffix
+
+	if err := d.fs.MkdirAll(filepath.Join(d.dir, collection), d.dirMode); err != nil {
+		return "", err
+	}
+
+	if err := d.writeFile(tmpPath, b); err != nil {
+		d.fs.Remove(tmpPath)
+		return "", err
+	}
+
+	return tmpPath, nil
+}
+
+func (d *Driver) Read(collection, resource string, v interface{}) error {
+	return d.ReadContext(context.Background(), collection, resource, v)
+}
+
+func (d *Driver) ReadContext(ctx context.Context, collection, resource string, v interface{}) error {
+	b, err := d.readRaw(ctx, collection, resource)
+	if err != nil {
+		return err
+	}
+
+	return d.codecFor(collection).Unmarshal(b, v)
+}
+
+// ReadRaw returns the stored bytes of a record without decoding them. With
+// the default codec they are the record's JSON.
+func (d *Driver) ReadRaw(collection, resource string) (json.RawMessage, error) {
+	b, err := d.readRaw(context.Background(), collection, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(json.RawMessage(nil), b...), nil
+}
+
+// ReadMap reads a record of unknown shape into a map. With the default codec
+// numbers are decoded as json.Number, see DecodeWithNumbers.
+func (d *Driver) ReadMap(collection, resource string) (map[string]interface{}, error) {
+	b, err := d.readRaw(context.Background(), collection, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+
+	if err := d.decode(collection, b, &m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// readRaw returns a record's decrypted, decompressed bytes, from the cache
+// when possible. The result may be shared with the cache and must not be
+// modified.
+func (d *Driver) readRaw(ctx context.Context, collection, resource string) (_ []byte, err error) {
+	defer d.observe(d.metrics.ObserveRead, "Read", collection, time.Now(), &err)
+
+	if collection == "" {
+		return nil, fmt.Errorf("%w - unable to read record", ErrEmptyCollection)
+	}
+
+	if resource == "" {
+		return nil, fmt.Errorf("%w - unable to read record (no name)", ErrEmptyResource)
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.ioLimit.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer d.ioLimit.release()
+
+	if err := d.expireRecord(mutex, collection, resource); err != nil {
+		return nil, err
+	}
+
+	if d.recoverTemp {
+		if err := d.recoverTempRecord(mutex, collection, resource); err != nil {
+			return nil, err
+		}
+	}
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	record := d.recordPath(collection, resource)
+
+	if b, ok := d.cache.get(record); ok {
+		return b, nil
+	}
+
+	if !d.mayContain(collection, resource) {
+		return nil, fmt.Errorf("%w: '%s' in '%s'", ErrRecordNotFound, resource, collection)
+	}
+
+	b, err := d.readRecord(record)
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: '%s' in '%s'", ErrRecordNotFound, resource, collection)
+		}
+		return nil, err
+	}
+
+	d.cache.add(record, b)
+
+	return b, nil
+}
+
+func (d *Driver) ReadAll(collection string) ([]string, error) {
+	return d.ReadAllContext(context.Background(), collection)
+}
+
+// ReadAllContext returns every record of a collection. A record that can't be
+// read doesn't abort the scan: the records that were read are returned along
+// with an error joining each failure. A record that disappears between
+// listing the collection and reading it is skipped silently.
+func (d *Driver) ReadAllContext(ctx context.Context, collection string) ([]string, error) {
+	raw, err := d.readAllRaw(ctx, collection)
+
+	var records []string
+
+	for _, r := range raw {
+		records = append(records, string(r))
+	}
+
+	return records, err
+}
+
+// ReadAllRaw is like ReadAll but returns each record as a json.RawMessage
+// that can be unmarshalled directly.
+func (d *Driver) ReadAllRaw(collection string) ([]json.RawMessage, error) {
+	return d.readAllRaw(context.Background(), collection)
+}
+
+func (d *Driver) readAllRaw(ctx context.Context, collection string) (_ []json.RawMessage, err error) {
+	defer d.observe(d.metrics.ObserveReadAll, "ReadAll", collection, time.Now(), &err)
+
+	if collection == "" {
+		return nil, fmt.Errorf("%w - unable to read", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.ioLimit.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer d.ioLimit.release()
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	resources, scan, err := d.scanCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []json.RawMessage
+	var errs []error
+
+	for _, resource := range resources {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		b, err := scan.read(resource)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to read '%s' in '%s': %w", resource, collection, err))
+			continue
+		}
+
+		records = append(records, b)
+	}
+
+	return records, errors.Join(errs...)
+}
+
+// ForEach calls fn with every record of a collection, one at a time, while
+// holding the collection's read lock. Iteration stops at the first error
+// returned by fn.
+func (d *Driver) ForEach(collection string, fn func(resource string, raw []byte) error) error {
+	return d.forEach(context.Background(), collection, fn)
+}
+
+func (d *Driver) forEach(ctx context.Context, collection string, fn func(resource string, raw []byte) error) error {
+	if collection == "" {
+		return fmt.Errorf("%w - unable to read", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return err
+	}
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	return d.eachRecord(ctx, collection, fn)
+}
+
+// eachRecord walks the records of a collection. Callers must hold the
+// collection's lock.
+func (d *Driver) eachRecord(ctx context.Context, collection string, fn func(resource string, raw []byte) error) error {
+	resources, scan, err := d.scanCollection(collection)
+	if err != nil {
+		return err
+	}
+
+	for _, resource := range resources {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		b, err := scan.read(resource)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := fn(resource, b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listResources returns the resource names of a collection sorted
+// lexicographically. Callers must hold the collection's lock.
+func (d *Driver) listResources(collection string) ([]string, error) {
+	return d.readResources(collection, false)
+}
+
+// liveResources is listResources leaving out records whose TTL has passed,
+// which read as missing until they are deleted. Callers must hold the
+// collection's lock.
+func (d *Driver) liveResources(collection string) ([]string, error) {
+	return d.readResources(collection, true)
+}
+
+func (d *Driver) readResources(collection string, live bool) ([]string, error) {
+	if d.singleFile {
+		return d.listSingle(collection)
+	}
+
+	files, err := d.fs.ReadDir(filepath.Join(d.dir, collection))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: '%s'", ErrCollectionNotFound, collection)
+		}
+		return nil, err
+	}
+
+	var resources []string
+
+	expiring := make(map[string]bool)
+
+	for _, file := range files {
+		if live && !file.IsDir() && strings.HasSuffix(file.Name(), expirySuffix) {
+			if resource, err := d.resourceName(strings.TrimSuffix(file.Name(), expirySuffix)); err == nil {
+				expiring[resource] = true
+			}
+			continue
+		}
+
+		if d.isRecordFile(collection, file) {
+			resource, err := d.resourceName(strings.TrimSuffix(file.Name(), d.format(collection).extension()))
+			if err != nil {
+				d.log.Warn("Skipping '%s' in '%s': %s", file.Name(), collection, err)
+				continue
+			}
+
+			resources = append(resources, resource)
+		}
+	}
+
+	if len(expiring) > 0 {
+		unexpired := resources[:0]
+
+		for _, resource := range resources {
+			if !expiring[resource] || !d.isExpired(d.recordPath(collection, resource)) {
+				unexpired = append(unexpired, resource)
+			}
+		}
+
+		resources = unexpired
+	}
+
+	sort.Strings(resources)
+
+	return resources, nil
+}
+
+// recordScan reads the records of one collection during a scan, see
+// scanCollection. In SingleFile mode it holds the collection's file, loaded
+// once for the whole scan, instead of loading it again for every record.
+type recordScan struct {
+	d          *Driver
+	collection string
+	records    map[string]json.RawMessage
+}
+
+// scanCollection lists a collection's unexpired resources, sorted, and
+// returns a recordScan to read them with. Callers must hold the collection's
+// lock while using it.
+func (d *Driver) scanCollection(collection string) ([]string, *recordScan, error) {
+	scan := &recordScan{d: d, collection: collection}
+
+	if !d.singleFile {
+		resources, err := d.liveResources(collection)
+		return resources, scan, err
+	}
+
+	records, err := d.loadCollection(collection)
+	if os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("%w: '%s'", ErrCollectionNotFound, collection)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scan.records = records
+
+	resources := make([]string, 0, len(records))
+	for resource := range records {
+		resources = append(resources, resource)
+	}
+
+	sort.Strings(resources)
+
+	return resources, scan, nil
+}
+
+// read returns a record like readRecord. A record that is gone fails with
+// an error satisfying os.IsNotExist.
+func (s *recordScan) read(resource string) ([]byte, error) {
+	path := s.d.recordPath(s.collection, resource)
+
+	if !s.d.singleFile {
+		return s.d.readRecord(path)
+	}
+
+	b, ok := s.records[resource]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: path, Err: fs.ErrNotExist}
+	}
+
+	return b, nil
+}
+
+// size returns the size of a record's file, or in SingleFile mode of the
+// record within its collection's file.
+func (s *recordScan) size(resource string) (int64, error) {
+	if s.d.singleFile {
+		b, err := s.read(resource)
+		return int64(len(b)), err
+	}
+
+	fi, err := s.d.fs.Stat(s.d.recordPath(s.collection, resource))
+	if err != nil {
+		return 0, err
+	}
+
+	return fi.Size(), nil
+}
+
+func (d *Driver) Delete(collection, resource string) error {
+	return d.DeleteContext(context.Background(), collection, resource)
+}
+
+func (d *Driver) DeleteContext(ctx context.Context, collection, resource string) (err error) {
+	defer d.observe(d.metrics.ObserveDelete, "Delete", collection, time.Now(), &err)
+
+	if collection == "" {
+		return fmt.Errorf("%w - unable to delete", ErrEmptyCollection)
+	}
+
+	if resource == "" {
+		return fmt.Errorf("%w - unable to delete record (no name)", ErrEmptyResource)
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	return d.deleteRecord(collection, resource)
+}
+
+// deleteRecord removes a record and its expiry, if any. Callers must hold
+// the collection's write lock.
+func (d *Driver) deleteRecord(collection, resource string) error {
+	if d.singleFile {
+		return d.deleteSingle(collection, resource)
+	}
+
+	record := d.recordPath(collection, resource)
+
+	if _, err := d.fs.Stat(record); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: '%s' in '%s'", ErrRecordNotFound, resource, collection)
+		}
+		return err
+	}
+
+	id, err := d.wal.begin(walEntry{Op: walDelete, Collection: collection, Resource: resource})
+	if err != nil {
+		return err
+	}
+	defer d.wal.end(id)
+
+	d.cache.remove(record)
+
+	if err := d.removeRecord(collection, record); err != nil {
+		return err
+	}
+
+	d.updateIndexes(collection, resource)
+	d.publish(OpDelete, collection, resource)
+
+	return d.clearExpiry(record)
+}
+
+// Exists reports whether a record is present without reading or decoding it.
+func (d *Driver) Exists(collection, resource string) (bool, error) {
+	if collection == "" {
+		return false, fmt.Errorf("%w - unable to check record", ErrEmptyCollection)
+	}
+
+	if resource == "" {
+		return false, fmt.Errorf("%w - unable to check record (no name)", ErrEmptyResource)
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return false, err
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return false, err
+	}
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	if !d.mayContain(collection, resource) {
+		return false, nil
+	}
+
+	record := d.recordPath(collection, resource)
+
+	if err := d.statRecord(record); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("unable to stat record '%s': %w", record, err)
+	}
+
+	return true, nil
+}
+
+// Path returns the absolute path of the file Write and Read use for a
+// record, after the same validation and resource encoding. It does not
+// touch the filesystem, so the file need not exist.
+func (d *Driver) Path(collection, resource string) (string, error) {
+	if collection == "" {
+		return "", fmt.Errorf("%w - unable to locate record", ErrEmptyCollection)
+	}
+
+	if resource == "" {
+		return "", fmt.Errorf("%w - unable to locate record (no name)", ErrEmptyResource)
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return "", err
+	}
+
+	return filepath.Abs(d.recordPath(collection, resource))
+}
+
+// Count returns the number of records in a collection without reading them.
+func (d *Driver) Count(collection string) (int, error) {
+	if collection == "" {
+		return 0, fmt.Errorf("%w - unable to count", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return 0, err
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	resources, err := d.liveResources(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(resources), nil
+}
+
+// Collections lists the collections stored under the DB directory.
+func (d *Driver) Collections() ([]string, error) {
+	if d.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	files, err := d.fs.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var collections []string
+
+	for _, file := range files {
+		if d.singleFile {
+			if d.isCollectionFile(file) {
+				collections = append(collections, strings.TrimSuffix(file.Name(), singleFileExt))
+			}
+			continue
+		}
+
+		if !file.IsDir() || strings.HasPrefix(file.Name(), ".") || d.isTemp(file.Name()) {
+			continue
+		}
+
+		collections = append(collections, file.Name())
+	}
+
+	return collections, nil
+}
+
+// allCollections lists every collection like Collections, but also the
+// nested ones below them, such as "orders/2024/jan".
+func (d *Driver) allCollections() ([]string, error) {
+	if d.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	var collections []string
+
+	if err := d.collectCollections("", &collections); err != nil {
+		return nil, err
+	}
+
+	return collections, nil
+}
+
+// collectCollections appends the collections in the directory of parent,
+// and recursively the ones nested in them, to collections. Hidden
+// directories such as a collection's .index are skipped.
+func (d *Driver) collectCollections(parent string, collections *[]string) error {
+	files, err := d.fs.ReadDir(filepath.Join(d.dir, filepath.FromSlash(parent)))
+	if err != nil {
+		if parent != "" && os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if parent != "" {
+			name = parent + "/" + name
+		}
+
+		if d.singleFile && d.isCollectionFile(file) {
+			*collections = append(*collections, strings.TrimSuffix(name, singleFileExt))
+			continue
+		}
+
+		if !file.IsDir() || strings.HasPrefix(file.Name(), ".") || d.isTemp(file.Name()) {
+			continue
+		}
+
+		if !d.singleFile {
+			*collections = append(*collections, name)
+		}
+
+		if err := d.collectCollections(name, collections); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Walk calls fn with the name of every record in every collection,
+// including nested ones, listing directories only and never reading record
+// contents. Each collection's
+// names are listed under its read lock, which is released before fn is
+// called, so fn may modify the database. Walk stops at the first error
+// returned by fn.
+func (d *Driver) Walk(fn func(collection, resource string) error) error {
+	collections, err := d.allCollections()
+	if err != nil {
+		return err
+	}
+
+	for _, collection := range collections {
+		mutex, err := d.getOrCreateMutex(collection)
+		if err != nil {
+			return err
+		}
+
+		mutex.RLock()
+		resources, err := d.liveResources(collection)
+		mutex.RUnlock()
+
+		if errors.Is(err, ErrCollectionNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, resource := range resources {
+			if err := fn(collection, resource); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// CreateCollection creates an empty collection, which is required before
+// writing to it when StrictCollections is set. It returns
+// ErrCollectionExists if the collection already exists.
+func (d *Driver) CreateCollection(collection string) error {
+	if collection == "" {
+		return fmt.Errorf("%w - unable to create", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return err
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if d.singleFile {
+		if _, err := d.fs.Stat(d.collectionFile(collection)); err == nil {
+			return fmt.Errorf("%w: '%s'", ErrCollectionExists, collection)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		if err := d.saveCollection(collection, map[string]json.RawMessage{}); err != nil {
+			return err
+		}
+
+		return d.syncDir(d.dir)
+	}
+
+	dir := filepath.Join(d.dir, collection)
+
+	if _, err := d.fs.Stat(dir); err == nil {
+		return fmt.Errorf("%w: '%s'", ErrCollectionExists, collection)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := d.fs.MkdirAll(dir, d.dirMode); err != nil {
+		return err
+	}
+
+	return d.syncDir(d.dir)
+}
+
+// DropCollection removes a collection and all of its records, and forgets
+// the collection's mutex so short-lived collections don't accumulate. It
+// returns ErrCollectionNotFound if the collection does not exist.
+func (d *Driver) DropCollection(collection string) error {
+	if collection == "" {
+		return fmt.Errorf("%w - unable to drop", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return err
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return err
+	}
+
+	if err := d.dropCollection(mutex, collection); err != nil {
+		return err
+	}
+
+	d.removeMutex(mutex)
+
+	return nil
+}
+
+// Truncate deletes every record of a collection but keeps the collection
+// itself, along with its ID sequence.
+func (d *Driver) Truncate(collection string) error {
+	if collection == "" {
+		return fmt.Errorf("%w - unable to truncate", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return err
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	resources, err := d.listResources(collection)
+	if err != nil {
+		return err
+	}
+
+	for _, resource := range resources {
+		if err := d.deleteRecord(collection, resource); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Driver) dropCollection(mutex *collectionMutex, collection string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if d.singleFile {
+		return d.dropSingle(collection)
+	}
+
+	dir := filepath.Join(d.dir, collection)
+
+	if _, err := d.fs.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: '%s'", ErrCollectionNotFound, collection)
+		}
+		return err
+	}
+
+	d.cache.removePrefix(dir + string(filepath.Separator))
+	d.resetBloom(collection)
+
+	return d.removeAll(dir)
+}
+
+// removeMutex forgets a collection's mutex unless another operation is
+// holding or waiting for it. It must not be called with the collection's
+// lock held.
+func (d *Driver) removeMutex(mutex *collectionMutex) {
+	d.mutexes.remove(mutex)
+}
+
+// Close stops background work such as expiry reapers and watchers, waits
+// for in-flight operations to finish and makes every later call fail with
+// ErrClosed. Closing an already closed Driver is a no-op.
+func (d *Driver) Close() error {
+	unlock, err := d.lockAll(true)
+	if errors.Is(err, ErrClosed) {
+		return nil
+	}
+
+	d.closed.Store(true)
+	stops := d.stops
+	d.stops = nil
+
+	unlock()
+
+	for _, stop := range stops {
+		stop()
+	}
+
+	d.watchers.closeAll()
+
+	err = d.wal.close()
+	if uerr := d.unlockDir(); err == nil {
+		err = uerr
+	}
+
+	return err
+}
+
+// Flush forces writes still waiting for a group commit, see
+// Options.CommitInterval, to disk now and returns once they are durable.
+// Without group commit every write is already durable when it returns, and
+// Flush does nothing.
+func (d *Driver) Flush() error {
+	if d.group == nil {
+		return nil
+	}
+
+	return d.group.flush(d.syncDir)
+}
+
+// lockFile is the file in the database directory that New takes its
+// advisory lock on.
+const lockFile = ".lock"
+
+// unlockDir releases the advisory lock taken by New, if any.
+func (d *Driver) unlockDir() error {
+	if d.lock == nil {
+		return nil
+	}
+
+	return d.lock.Close()
+}
+
+// onClose registers fn to be called by Close. It reports false, without
+// registering, if the Driver is already closed.
+func (d *Driver) onClose(fn func()) bool {
+	d.rwMutex.Lock()
+	defer d.rwMutex.Unlock()
+
+	if d.closed.Load() {
+		return false
+	}
+
+	d.stops = append(d.stops, fn)
+
+	return true
+}
+
+// lockAll blocks new operations on every collection and waits for in-flight
+// ones to finish, taking each known collection lock for reading or writing.
+// It returns a func releasing everything.
+func (d *Driver) lockAll(write bool) (func(), error) {
+	d.rwMutex.Lock()
+
+	if d.closed.Load() {
+		d.rwMutex.Unlock()
+		return nil, ErrClosed
+	}
+
+	mutexes := d.mutexes.freeze()
+
+	for _, m := range mutexes {
+		if write {
+			m.Lock()
+		} else {
+			m.RLock()
+		}
+	}
+
+	return func() {
+		for _, m := range mutexes {
+			if write {
+				m.Unlock()
+			} else {
+				m.RUnlock()
+			}
+		}
+
+		d.mutexes.thaw()
+		d.rwMutex.Unlock()
+	}, nil
+}
+
+// lockCollections takes the locks of several collections in name order. All
+// mutexes are resolved before any of them is locked, so no lookup, which
+// may wait for lockAll, happens with a collection lock held. It returns a
+// func releasing the locks.
+func (d *Driver) lockCollections(write bool, collections ...string) (func(), error) {
+	names := append([]string(nil), collections...)
+	sort.Strings(names)
+
+	var mutexes []*collectionMutex
+
+	for i, name := range names {
+		if i > 0 && name == names[i-1] {
+			continue
+		}
+
+		m, err := d.getOrCreateMutex(name)
+		if err != nil {
+			return nil, err
+		}
+
+		mutexes = append(mutexes, m)
+	}
+
+	for _, m := range mutexes {
+		if write {
+			m.Lock()
+		} else {
+			m.RLock()
+		}
+	}
+
+	return func() {
+		for i := len(mutexes) - 1; i >= 0; i-- {
+			if write {
+				mutexes[i].Unlock()
+			} else {
+				mutexes[i].RUnlock()
+			}
+		}
+	}, nil
+}
+
+// getOrCreateMutex returns the collection's mutex. It takes no Driver-wide
+// lock: closed is checked atomically and the lookup only locks a shard of
+// the table, so operations on different collections don't contend. lockAll
+// still excludes them by freezing the table.
+func (d *Driver) getOrCreateMutex(collection string) (*collectionMutex, error) {
+	if d.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	return d.mutexes.lookup(collection), nil
+}
+
+// validateNames rejects names that could escape the DB directory once
+// joined into a path, or that end in the Driver's TempSuffix. A collection
+// may be nested with forward slashes, as in "orders/2024/jan"; each of its
+// segments must be a valid name.
+func (d *Driver) validateNames(collection string, resources ...string) error {
+	return checkNames(d.tempSuffix, collection, resources...)
+}
+
+func (d *Driver) validateResource(resource string) error {
+	return checkResource(d.tempSuffix, resource)
+}
+
+func (d *Driver) validateName(name string) error {
+	return checkName(d.tempSuffix, name)
+}
+
+// defaultTempSuffix is Options.TempSuffix when it isn't set.
+const defaultTempSuffix = ".temp"
+
+// checkNames is validateNames for a given temp suffix.
+func checkNames(tempSuffix, collection string, resources ...string) error {
+	for _, segment := range strings.Split(collection, "/") {
+		if err := checkName(tempSuffix, segment); err != nil {
+			return fmt.Errorf("%w: '%s'", ErrInvalidName, collection)
+		}
+	}
+
+	for _, resource := range resources {
+		if err := checkResource(tempSuffix, resource); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reservedNames are used for the DB's own bookkeeping files inside a
+// collection and can't be used as resource names.
+var reservedNames = map[string]bool{
+	seqFile: true,
+	"_meta": true,
+	"_schema": true,
+}
+
+func checkResource(tempSuffix, resource string) error {
+	if reservedNames[resource] {
+		return fmt.Errorf("%w: '%s' is reserved", ErrInvalidName, resource)
+	}
+
+	return checkName(tempSuffix, resource)
+}
+
+// checkName checks a single path segment. Hidden names and the temp suffix
+// are rejected so they can't be confused with internal files.
+func checkName(tempSuffix, name string) error {
+	switch {
+	case strings.ContainsAny(name, "/\\\x00"), strings.Contains(name, ".."):
+	case strings.TrimSpace(name) == "", filepath.Clean(name) == ".":
+	case strings.HasPrefix(name, "."), strings.HasSuffix(name, tempSuffix):
+	default:
+		return nil
+	}
+
+	return fmt.Errorf("%w: '%s'", ErrInvalidName, name)
+}
+
+// writeFileAtomic writes a small bookkeeping file through a temp file and
+// rename, so readers never see it half written.
+func (d *Driver) writeFileAtomic(path string, b []byte) error {
+	tmpPath := path + d.tempSuffix
+
+	if err := d.writeFile(tmpPath, b); err != nil {
+		d.fs.Remove(tmpPath)
+		return err
+	}
+
+	if err := d.fs.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	return d.syncDir(filepath.Dir(path))
+}
+
+// writeFile writes b to path through the FS, which for the OS fsyncs it
+// unless NoSync is set.
+func (d *Driver) writeFile(path string, b []byte) error {
+	return d.fs.WriteFile(path, b, d.fileMode)
+}
+
+// syncDir fsyncs a directory so renames into it survive a crash, when the
+// FS supports it.
+func (d *Driver) syncDir(dir string) error {
+	if d.noSync {
+		return nil
+	}
+
+	if fs, ok := d.fs.(dirSyncer); ok {
+		return fs.SyncDir(dir)
+	}
+
+	return nil
+}
+
+func (d *Driver) recordPath(collection, resource string) string {
+	return filepath.Join(d.dir, collection, d.resourceFile(resource)+d.format(collection).extension())
+}
+
+// isTemp reports whether name is a temp file of an unfinished write.
+func (d *Driver) isTemp(name string) bool {
+	return strings.HasSuffix(name, d.tempSuffix)
+}
+
+// checkTempSuffix rejects temp suffixes that would move temp files out of
+// their record's directory, possibly onto another device where rename is
+// not atomic, or that would make temp files look like records.
+func (d *Driver) checkTempSuffix(f format) error {
+	if strings.ContainsAny(d.tempSuffix, "/\\\x00") {
+		return fmt.Errorf("invalid TempSuffix %q: temp files must stay in the record's directory for the rename to be atomic", d.tempSuffix)
+	}
+
+	if strings.HasSuffix(d.tempSuffix, f.extension()) || strings.HasSuffix(d.tempSuffix, expirySuffix) {
+		return fmt.Errorf("invalid TempSuffix %q: temp files would be mistaken for records or expiry files", d.tempSuffix)
+	}
+
+	return nil
+}
+
+// readRecord reads a record file and returns its codec-encoded contents,
+// without any metadata envelope.
+func (d *Driver) readRecord(path string) ([]byte, error) {
+	if d.singleFile {
+		return d.readSingle(path)
+	}
+
+	b, err := d.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	_, data := d.splitEnvelope(b)
+
+	return data, nil
+}
+
+// readFile reads a record file, undoing encryption and compression. A
+// zero-byte file, as left by a truncated write, fails with ErrEmptyRecord
+// rather than a decoding error.
+func (d *Driver) readFile(path string) ([]byte, error) {
+	b, err := d.fs.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) == 0 {
+		return nil, fmt.Errorf("%w: '%s'", ErrEmptyRecord, path)
+	}
+
+	return d.formatOf(path).decode(b)
+}
+
+func (d *Driver) isRecordFile(collection string, file os.DirEntry) bool {
+	name := file.Name()
+
+	if file.IsDir() || d.isTemp(name) || name == schemaFile {
+		return false
+	}
+
+	return strings.HasSuffix(name, d.format(collection).extension())
 }
 
 type Address struct {
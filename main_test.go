@@ -0,0 +1,954 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// testLogger is a Logger that records warnings and discards everything
+// else, keeping test output quiet.
+type testLogger struct {
+	mu       sync.Mutex
+	warnings []string
+}
+
+func (l *testLogger) Fatal(string, ...interface{}) {}
+func (l *testLogger) Error(string, ...interface{}) {}
+func (l *testLogger) Info(string, ...interface{})  {}
+func (l *testLogger) Debug(string, ...interface{}) {}
+func (l *testLogger) Trace(string, ...interface{}) {}
+
+func (l *testLogger) Warn(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+}
+
+func (l *testLogger) Warnings() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]string(nil), l.warnings...)
+}
+
+// newTestDriver opens a Driver on a fresh temp directory, closed when the
+// test ends. A nil opts uses the defaults, apart from the quiet logger.
+func newTestDriver(t testing.TB, opts *Options) *Driver {
+	t.Helper()
+
+	return openTestDriver(t, t.TempDir(), opts)
+}
+
+// openTestDriver opens a Driver on dir, closed when the test ends.
+func openTestDriver(t testing.TB, dir string, opts *Options) *Driver {
+	t.Helper()
+
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = &testLogger{}
+	}
+
+	d, err := New(dir, opts)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+
+	t.Cleanup(func() { d.Close() })
+
+	return d
+}
+
+// sampleUsers are the records main writes.
+var sampleUsers = []User{
+	{"Mrinal", "19", "3423251", "Aramco", Address{"Varanasi", "Up", "India", "3424"}},
+	{"Utkarsh", "18", "3423234", "Airtel", Address{"JanakPuri", "Delhi", "India", "8912"}},
+	{"Prachi", "17", "3423251", "Aramco", Address{"Bhidaur", "Tamil Nadu", "India", "1321"}},
+}
+
+// writeSampleUsers writes sampleUsers to collection, keyed by name.
+func writeSampleUsers(t testing.TB, d *Driver, collection string) {
+	t.Helper()
+
+	for _, user := range sampleUsers {
+		if err := d.Write(collection, user.Name, user); err != nil {
+			t.Fatalf("Write %s: %s", user.Name, err)
+		}
+	}
+}
+
+// userNames decodes records as Users and returns their names, sorted.
+func userNames(t testing.TB, records []string) []string {
+	t.Helper()
+
+	names := make([]string, 0, len(records))
+
+	for _, record := range records {
+		var user User
+		if err := json.Unmarshal([]byte(record), &user); err != nil {
+			t.Fatalf("unmarshal %q: %s", record, err)
+		}
+
+		names = append(names, user.Name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func TestWriteRead(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	var user User
+	if err := d.Read("users", "Mrinal", &user); err != nil {
+		t.Fatal(err)
+	}
+
+	if user != sampleUsers[0] {
+		t.Fatalf("Read = %+v, want %+v", user, sampleUsers[0])
+	}
+
+	if err := d.Read("users", "Nobody", &user); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("Read of a missing record = %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestReadAllSkipsNonRecordFiles(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	for name, content := range map[string]string{
+		"Ghost.json.temp": `{"Name": "Ghost"}`,
+		"README.md":       "# users",
+		".DS_Store":       "\x00\x01",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, "users", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := d.ReadAll("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := strings.Join(userNames(t, records), ","), "Mrinal,Prachi,Utkarsh"; got != want {
+		t.Fatalf("ReadAll returned %s, want %s", got, want)
+	}
+}
+
+func TestInvalidNames(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	for _, tc := range []struct{ collection, resource string }{
+		{"users", "../secret"},
+		{"users", "a/b"},
+		{"users", `a\b`},
+		{"users", "a\x00b"},
+		{"users", "."},
+		{"users", "  "},
+		{"../users", "Mrinal"},
+		{"users/..", "Mrinal"},
+		{"users//active", "Mrinal"},
+	} {
+		if err := d.Write(tc.collection, tc.resource, sampleUsers[0]); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Write(%q, %q) = %v, want ErrInvalidName", tc.collection, tc.resource, err)
+		}
+
+		var user User
+		if err := d.Read(tc.collection, tc.resource, &user); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Read(%q, %q) = %v, want ErrInvalidName", tc.collection, tc.resource, err)
+		}
+
+		if err := d.Delete(tc.collection, tc.resource); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Delete(%q, %q) = %v, want ErrInvalidName", tc.collection, tc.resource, err)
+		}
+	}
+}
+
+func TestCollections(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	if err := d.Write("companies", "Aramco", map[string]string{"Name": "Aramco"}); err != nil {
+		t.Fatal(err)
+	}
+
+	collections, err := d.Collections()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(collections)
+
+	if got, want := strings.Join(collections, ","), "companies,users"; got != want {
+		t.Fatalf("Collections = %s, want %s", got, want)
+	}
+}
+
+func TestDropCollection(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	if err := d.DropCollection("users"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := d.DriverStats().Mutexes; n != 0 {
+		t.Fatalf("%d mutexes left after DropCollection, want 0", n)
+	}
+
+	if _, err := d.ReadAll("users"); !errors.Is(err, ErrCollectionNotFound) {
+		t.Fatalf("ReadAll after DropCollection = %v, want ErrCollectionNotFound", err)
+	}
+
+	if err := d.DropCollection("users"); !errors.Is(err, ErrCollectionNotFound) {
+		t.Fatalf("second DropCollection = %v, want ErrCollectionNotFound", err)
+	}
+}
+
+func TestValidatorRejectsRecord(t *testing.T) {
+	errNoName := errors.New("record has no Name")
+
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, &Options{
+		Validator: func(collection string, raw []byte) error {
+			var fields map[string]interface{}
+			if err := json.Unmarshal(raw, &fields); err != nil {
+				return err
+			}
+
+			if _, ok := fields["Name"]; !ok {
+				return errNoName
+			}
+
+			return nil
+		},
+	})
+
+	if err := d.Write("users", "Mrinal", sampleUsers[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("users", "Anonymous", map[string]string{"Company": "Aramco"}); !errors.Is(err, errNoName) {
+		t.Fatalf("Write without a Name = %v, want the validator's error", err)
+	}
+
+	files, err := os.ReadDir(filepath.Join(dir, "users"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 || files[0].Name() != "Mrinal.json" {
+		t.Fatalf("collection holds %v, want only Mrinal.json", files)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	if err := d.Truncate("users"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := d.Count("users"); err != nil || n != 0 {
+		t.Fatalf("Count after Truncate = %d, %v, want 0", n, err)
+	}
+
+	collections, err := d.Collections()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(collections) != 1 || collections[0] != "users" {
+		t.Fatalf("Collections after Truncate = %v, want [users]", collections)
+	}
+
+	if err := d.Truncate("missing"); !errors.Is(err, ErrCollectionNotFound) {
+		t.Fatalf("Truncate of a missing collection = %v, want ErrCollectionNotFound", err)
+	}
+}
+
+func TestNewRejectsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := New(path, &Options{Logger: &testLogger{}})
+	if err == nil {
+		t.Fatal("New on a regular file succeeded")
+	}
+
+	if want := fmt.Sprintf("path %q exists and is not a directory", path); err.Error() != want {
+		t.Fatalf("New = %q, want %q", err, want)
+	}
+}
+
+func TestGetOrCreateRace(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	const goroutines = 32
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		creates int
+	)
+
+	start := make(chan struct{})
+
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+
+		go func(g int) {
+			defer wg.Done()
+
+			<-start
+
+			var user User
+			err := d.GetOrCreate("users", "Mrinal", &user, func() (interface{}, error) {
+				mu.Lock()
+				creates++
+				mu.Unlock()
+
+				return User{Name: "Mrinal", Contact: fmt.Sprint(g)}, nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(g)
+	}
+
+	close(start)
+	wg.Wait()
+
+	if creates != 1 {
+		t.Fatalf("create was called %d times, want 1", creates)
+	}
+}
+
+func TestNestedCollection(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, nil)
+
+	order := map[string]interface{}{"Item": "Ledger", "Total": json.Number("42")}
+
+	if err := d.Write("orders/2024/jan", "1001", order); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "orders", "2024", "jan", "1001.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]interface{}
+	if err := d.Read("orders/2024/jan", "1001", &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got["Item"] != "Ledger" || got["Total"] != json.Number("42") {
+		t.Fatalf("Read = %v, want %v", got, order)
+	}
+
+	records, err := d.ReadAll("orders/2024/jan")
+	if err != nil || len(records) != 1 {
+		t.Fatalf("ReadAll = %v, %v, want one record", records, err)
+	}
+
+	var walked []string
+	if err := d.Walk(func(collection, resource string) error {
+		walked = append(walked, collection+"/"+resource)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(walked) != 1 || walked[0] != "orders/2024/jan/1001" {
+		t.Fatalf("Walk visited %v, want [orders/2024/jan/1001]", walked)
+	}
+
+	if err := d.Delete("orders/2024/jan", "1001"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	stale := sampleUsers[0]
+	stale.Company = "Airtel"
+
+	replacement := sampleUsers[0]
+	replacement.Contact = "0000000"
+
+	swapped, err := d.CompareAndSwap("users", "Mrinal", stale, replacement)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if swapped {
+		t.Fatal("CompareAndSwap with a mismatched expected value swapped")
+	}
+
+	var user User
+	if err := d.Read("users", "Mrinal", &user); err != nil {
+		t.Fatal(err)
+	}
+
+	if user != sampleUsers[0] {
+		t.Fatalf("record after a failed swap = %+v, want %+v", user, sampleUsers[0])
+	}
+
+	if swapped, err := d.CompareAndSwap("users", "Mrinal", sampleUsers[0], replacement); err != nil || !swapped {
+		t.Fatalf("CompareAndSwap with the current value = %v, %v, want a swap", swapped, err)
+	}
+
+	if err := d.Read("users", "Mrinal", &user); err != nil || user != replacement {
+		t.Fatalf("record after a swap = %+v, %v, want %+v", user, err, replacement)
+	}
+
+	if _, err := d.CompareAndSwap("users", "Nobody", stale, replacement); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("CompareAndSwap of a missing record = %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("users", "Mrinal", sampleUsers[0]); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Write after Close = %v, want ErrClosed", err)
+	}
+
+	var user User
+	if err := d.Read("users", "Mrinal", &user); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Read after Close = %v, want ErrClosed", err)
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatalf("second Close = %v", err)
+	}
+}
+
+func TestReservedNames(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	for _, resource := range []string{"Mrinal.temp", "Mrinal.json.temp", ".hidden", seqFile, "_meta", "_schema"} {
+		if err := d.Write("users", resource, sampleUsers[0]); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Write of %q = %v, want ErrInvalidName", resource, err)
+		}
+	}
+
+	for _, collection := range []string{"users.temp", ".trash", "users/.index"} {
+		if err := d.Write(collection, "Mrinal", sampleUsers[0]); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Write to %q = %v, want ErrInvalidName", collection, err)
+		}
+	}
+}
+
+// hookFS is the OS filesystem, calling onRead before every ReadFile.
+type hookFS struct {
+	osFS
+	onRead func(name string)
+}
+
+func (fs hookFS) ReadFile(name string) ([]byte, error) {
+	fs.onRead(name)
+
+	return fs.osFS.ReadFile(name)
+}
+
+func TestReadAllSkipsRecordDeletedMidScan(t *testing.T) {
+	dir := t.TempDir()
+
+	var once sync.Once
+
+	d := openTestDriver(t, dir, &Options{FS: hookFS{onRead: func(name string) {
+		if filepath.Base(name) != "Mrinal.json" {
+			return
+		}
+
+		// Another process deletes a record the scan has listed but not
+		// read yet.
+		once.Do(func() { os.Remove(filepath.Join(dir, "users", "Utkarsh.json")) })
+	}}})
+
+	writeSampleUsers(t, d, "users")
+
+	records, err := d.ReadAll("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := strings.Join(userNames(t, records), ","), "Mrinal,Prachi"; got != want {
+		t.Fatalf("ReadAll returned %s, want %s", got, want)
+	}
+}
+
+func TestReadRawAndReadMap(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.Write("accounts", "big", map[string]interface{}{"ID": json.Number("12345678901234567"), "Name": "Mrinal"}); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := d.ReadRaw("accounts", "big")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !json.Valid(raw) || !strings.Contains(string(raw), "12345678901234567") {
+		t.Fatalf("ReadRaw = %s", raw)
+	}
+
+	fields, err := d.ReadMap("accounts", "big")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fields["ID"] != json.Number("12345678901234567") || fields["Name"] != "Mrinal" {
+		t.Fatalf("ReadMap = %v", fields)
+	}
+
+	if _, err := d.ReadRaw("accounts", "missing"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("ReadRaw of a missing record = %v, want ErrRecordNotFound", err)
+	}
+
+	if _, err := d.ReadMap("accounts", "missing"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("ReadMap of a missing record = %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestSkipIdenticalWrites(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, &Options{SkipIdenticalWrites: true})
+
+	writeSampleUsers(t, d, "users")
+
+	path := filepath.Join(dir, "users", "Mrinal.json")
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	if err := os.Chtimes(path, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("users", "Mrinal", sampleUsers[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !fi.ModTime().Equal(past) {
+		t.Fatalf("identical write changed the mtime to %v, want %v", fi.ModTime(), past)
+	}
+
+	changed := sampleUsers[0]
+	changed.Company = "Airtel"
+
+	if err := d.Write("users", "Mrinal", changed); err != nil {
+		t.Fatal(err)
+	}
+
+	if fi, err := os.Stat(path); err != nil || fi.ModTime().Equal(past) {
+		t.Fatalf("changed write left the mtime at %v: %v", past, err)
+	}
+}
+
+func TestCompactOutput(t *testing.T) {
+	sizes := make(map[bool]int)
+
+	for _, compact := range []bool{false, true} {
+		dir := t.TempDir()
+		d := openTestDriver(t, dir, &Options{Compact: compact})
+
+		if err := d.Write("users", "Mrinal", sampleUsers[0]); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := os.ReadFile(filepath.Join(dir, "users", "Mrinal.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sizes[compact] = len(b)
+
+		if compact && strings.ContainsAny(strings.TrimSuffix(string(b), "\n"), "\t\n") {
+			t.Fatalf("compact record contains tabs or newlines: %q", b)
+		}
+
+		if !compact && !strings.Contains(string(b), "\n\t") {
+			t.Fatalf("default record is not tab-indented: %q", b)
+		}
+	}
+
+	if sizes[true] >= sizes[false] {
+		t.Fatalf("compact record is %d bytes, indented %d", sizes[true], sizes[false])
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	dir := t.TempDir()
+
+	d := openTestDriver(t, dir, nil)
+	writeSampleUsers(t, d, "users")
+	d.Close()
+
+	ro := openTestDriver(t, dir, &Options{ReadOnly: true})
+
+	for name, call := range map[string]func() error{
+		"Write":       func() error { return ro.Write("users", "Kid", User{Name: "Kid"}) },
+		"Delete":      func() error { return ro.Delete("users", "Mrinal") },
+		"Rename":      func() error { return ro.Rename("users", "Mrinal", "Mrinaal") },
+		"WriteBatch":  func() error { return ro.WriteBatch("users", map[string]interface{}{"Kid": User{Name: "Kid"}}) },
+		"Truncate":    func() error { return ro.Truncate("users") },
+		"Drop":        func() error { return ro.DropCollection("users") },
+		"CreateIndex": func() error { return ro.CreateIndex("users", "Company") },
+		"Insert": func() error {
+			_, err := ro.Insert("users", User{Name: "Kid"})
+			return err
+		},
+		"Cleanup": func() error {
+			_, err := ro.Cleanup()
+			return err
+		},
+		"Transaction": func() error {
+			return ro.Transaction(func(tx *Tx) error { return tx.Delete("users", "Mrinal") })
+		},
+	} {
+		if err := call(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s in read-only mode = %v, want ErrReadOnly", name, err)
+		}
+	}
+
+	records, err := ro.ReadAll("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := strings.Join(userNames(t, records), ","), "Mrinal,Prachi,Utkarsh"; got != want {
+		t.Fatalf("ReadAll in read-only mode returned %s, want %s", got, want)
+	}
+
+	var user User
+	if err := ro.Read("users", "Mrinal", &user); err != nil || user != sampleUsers[0] {
+		t.Fatalf("Read in read-only mode = %+v, %v", user, err)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	var walking bool
+
+	d := newTestDriver(t, &Options{FS: hookFS{onRead: func(name string) {
+		if walking {
+			t.Errorf("Walk read %s", name)
+		}
+	}}})
+
+	writeSampleUsers(t, d, "users")
+	writeSampleUsers(t, d, "staff")
+
+	visits := make(map[string]int)
+
+	walking = true
+	err := d.Walk(func(collection, resource string) error {
+		visits[collection+"/"+resource]++
+		return nil
+	})
+	walking = false
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(visits) != 2*len(sampleUsers) {
+		t.Fatalf("Walk visited %v, want every sample record", visits)
+	}
+
+	for _, collection := range []string{"users", "staff"} {
+		for _, user := range sampleUsers {
+			if n := visits[collection+"/"+user.Name]; n != 1 {
+				t.Errorf("Walk visited %s/%s %d times, want once", collection, user.Name, n)
+			}
+		}
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+
+	if err := d.Walk(func(string, string) error { calls++; return stop }); err != stop || calls != 1 {
+		t.Fatalf("Walk with a failing fn = %v after %d calls, want %v after 1", err, calls, stop)
+	}
+}
+
+func TestMaxRecordBytes(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, &Options{MaxRecordBytes: 512})
+
+	if err := d.Write("users", "Mrinal", sampleUsers[0]); err != nil {
+		t.Fatalf("Write of a small record: %s", err)
+	}
+
+	big := sampleUsers[1]
+	big.Company = strings.Repeat("x", 1024)
+
+	if err := d.Write("users", big.Name, big); !errors.Is(err, ErrRecordTooLarge) {
+		t.Fatalf("Write of an oversized record = %v, want ErrRecordTooLarge", err)
+	}
+
+	files, err := os.ReadDir(filepath.Join(dir, "users"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 || files[0].Name() != "Mrinal.json" {
+		t.Fatalf("collection holds %v, want only Mrinal.json", files)
+	}
+}
+
+// renameLogFS is the OS filesystem, recording every rename.
+type renameLogFS struct {
+	osFS
+
+	mu      sync.Mutex
+	renames [][2]string
+}
+
+func (fs *renameLogFS) Rename(oldpath, newpath string) error {
+	fs.mu.Lock()
+	fs.renames = append(fs.renames, [2]string{oldpath, newpath})
+	fs.mu.Unlock()
+
+	return fs.osFS.Rename(oldpath, newpath)
+}
+
+func TestTempSuffix(t *testing.T) {
+	dir := t.TempDir()
+	fs := &renameLogFS{}
+	d := openTestDriver(t, dir, &Options{FS: fs, TempSuffix: ".part"})
+
+	if err := d.Write("users", "Mrinal", sampleUsers[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	record := filepath.Join(dir, "users", "Mrinal.json")
+	if want := [2]string{record + ".part", record}; len(fs.renames) != 1 || fs.renames[0] != want {
+		t.Fatalf("Write renamed %v, want %v", fs.renames, want)
+	}
+
+	if _, err := os.Stat(record + ".part"); !os.IsNotExist(err) {
+		t.Fatalf("temp file left behind: %v", err)
+	}
+
+	var user User
+	if err := d.Read("users", "Mrinal", &user); err != nil || user != sampleUsers[0] {
+		t.Fatalf("Read = %+v, %v", user, err)
+	}
+
+	if err := d.Write("users", "Mrinal.part", sampleUsers[0]); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("Write of a name ending in the temp suffix = %v, want ErrInvalidName", err)
+	}
+
+	if err := d.Write("users.part", "Mrinal", sampleUsers[0]); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("Write to a collection ending in the temp suffix = %v, want ErrInvalidName", err)
+	}
+
+	fs.renames = nil
+
+	if err := d.CopyCollection("users", "users_backup"); err != nil {
+		t.Fatal(err)
+	}
+
+	copied := [2]string{filepath.Join(dir, "users_backup.part"), filepath.Join(dir, "users_backup")}
+	if last := fs.renames[len(fs.renames)-1]; last != copied {
+		t.Fatalf("CopyCollection's last rename = %v, want %v", last, copied)
+	}
+
+	for _, suffix := range []string{"/tmp", ".json", expirySuffix} {
+		if _, err := New(t.TempDir(), &Options{Logger: &testLogger{}, TempSuffix: suffix}); err == nil {
+			t.Errorf("New with TempSuffix %q succeeded", suffix)
+		}
+	}
+}
+
+func TestMarshalAndIOErrors(t *testing.T) {
+	fs := &flakyFS{err: syscall.ENOSPC, failures: 1 << 30}
+	d := newTestDriver(t, &Options{FS: fs})
+
+	err := d.Write("users", "broken", map[string]interface{}{"ch": make(chan int)})
+	if !errors.Is(err, ErrMarshal) || errors.Is(err, ErrIO) {
+		t.Fatalf("Write of a channel = %v, want ErrMarshal only", err)
+	}
+
+	if fs.renames != 0 {
+		t.Fatalf("Write of a channel touched disk")
+	}
+
+	for name, write := range map[string]func() error{
+		"Write":      func() error { return d.Write("users", "Mrinal", sampleUsers[0]) },
+		"WriteBatch": func() error { return d.WriteBatch("users", map[string]interface{}{"Mrinal": sampleUsers[0]}) },
+	} {
+		err := write()
+		if !errors.Is(err, ErrIO) || errors.Is(err, ErrMarshal) {
+			t.Errorf("%s on a full disk = %v, want ErrIO only", name, err)
+		}
+
+		if !errors.Is(err, syscall.ENOSPC) {
+			t.Errorf("%s on a full disk = %v, want the cause kept", name, err)
+		}
+	}
+}
+
+func TestPath(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, nil)
+
+	path, err := d.Path("users", "Mrinal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !filepath.IsAbs(path) {
+		t.Fatalf("Path = %s, want an absolute path", path)
+	}
+
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		t.Fatalf("Path = %s, want a path under %s", path, dir)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Path touched the filesystem: %v", err)
+	}
+
+	if err := d.Write("users", "Mrinal", sampleUsers[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Write didn't use Path: %s", err)
+	}
+
+	if _, err := d.Path("users", "../../etc/passwd"); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("Path of an escaping resource = %v, want ErrInvalidName", err)
+	}
+}
+
+func TestStrictCollections(t *testing.T) {
+	t.Run("Strict", func(t *testing.T) {
+		d := newTestDriver(t, &Options{StrictCollections: true})
+
+		if err := d.Write("uesrs", "Mrinal", sampleUsers[0]); !errors.Is(err, ErrCollectionNotFound) {
+			t.Fatalf("Write to an unknown collection = %v, want ErrCollectionNotFound", err)
+		}
+
+		if err := d.WriteBatch("uesrs", map[string]interface{}{"Mrinal": sampleUsers[0]}); !errors.Is(err, ErrCollectionNotFound) {
+			t.Fatalf("WriteBatch to an unknown collection = %v, want ErrCollectionNotFound", err)
+		}
+
+		if collections, err := d.Collections(); err != nil || len(collections) != 0 {
+			t.Fatalf("Collections = %v, %v, want none", collections, err)
+		}
+
+		if err := d.CreateCollection("users"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := d.CreateCollection("users"); !errors.Is(err, ErrCollectionExists) {
+			t.Fatalf("second CreateCollection = %v, want ErrCollectionExists", err)
+		}
+
+		writeSampleUsers(t, d, "users")
+
+		if err := d.MoveCollection("users", "Mrinal", "uesrs", "Mrinal"); !errors.Is(err, ErrCollectionNotFound) {
+			t.Fatalf("MoveCollection to an unknown collection = %v, want ErrCollectionNotFound", err)
+		}
+	})
+
+	t.Run("NonStrict", func(t *testing.T) {
+		d := newTestDriver(t, nil)
+
+		if err := d.Write("uesrs", "Mrinal", sampleUsers[0]); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := d.WriteBatch("staff", map[string]interface{}{"Mrinal": sampleUsers[0]}); err != nil {
+			t.Fatal(err)
+		}
+
+		collections, err := d.Collections()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := strings.Join(collections, ","), "staff,uesrs"; got != want {
+			t.Fatalf("Collections = %s, want %s", got, want)
+		}
+	})
+}
+
+func TestEmptyRecordFile(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	if err := os.WriteFile(filepath.Join(dir, "users", "Truncated.json"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var user User
+	if err := d.Read("users", "Truncated", &user); !errors.Is(err, ErrEmptyRecord) {
+		t.Fatalf("Read of a 0-byte record = %v, want ErrEmptyRecord", err)
+	}
+
+	records, err := d.ReadAll("users")
+	if !errors.Is(err, ErrEmptyRecord) {
+		t.Fatalf("ReadAll = %v, want it to report ErrEmptyRecord", err)
+	}
+
+	if got, want := strings.Join(userNames(t, records), ","), "Mrinal,Prachi,Utkarsh"; got != want {
+		t.Fatalf("ReadAll returned %s, want the other records %s", got, want)
+	}
+
+	report, err := d.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if corrupt := report.Collections["users"].Corrupt; len(corrupt) != 1 || corrupt[0] != "Truncated" {
+		t.Fatalf("Verify reported %v as corrupt, want [Truncated]", corrupt)
+	}
+}
@@ -0,0 +1,61 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileAndDirMode(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, &Options{FileMode: 0600, DirMode: 0700})
+
+	writeSampleUsers(t, d, "users")
+
+	for path, want := range map[string]os.FileMode{
+		filepath.Join(dir, "users"):                0700 | os.ModeDir,
+		filepath.Join(dir, "users", "Mrinal.json"): 0600,
+	} {
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := fi.Mode(); got != want {
+			t.Errorf("mode of %s = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestReadAllReturnsReadableRecords(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions don't apply to root")
+	}
+
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	if err := os.Chmod(filepath.Join(dir, "users", "Utkarsh.json"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := d.ReadAll("users")
+	if !errors.Is(err, fs.ErrPermission) {
+		t.Fatalf("ReadAll = %v, want a permission error", err)
+	}
+
+	if !strings.Contains(err.Error(), "'Utkarsh'") {
+		t.Fatalf("ReadAll error %q doesn't name the unreadable record", err)
+	}
+
+	if got, want := strings.Join(userNames(t, records), ","), "Mrinal,Prachi"; got != want {
+		t.Fatalf("ReadAll returned %s, want the readable records %s", got, want)
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Cleanup removes temp files left behind by writes that crashed before their
+// rename, and the temp directories of a CopyCollection that crashed before
+// renaming its copy into place, and returns how many were deleted. Each
+// collection, nested ones included, is cleaned under its write lock, and a
+// temp directory under the lock of the collection it was copied to.
+func (d *Driver) Cleanup() (int, error) {
+	if d.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	collections, err := d.allCollections()
+	if err != nil {
+		return 0, err
+	}
+
+	removed, err := d.cleanupTempDirs("")
+	if err != nil {
+		return removed, err
+	}
+
+	for _, collection := range collections {
+		n, err := d.cleanupCollection(collection)
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+
+		n, err = d.cleanupTempDirs(collection)
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+
+	return removed, nil
+}
+
+// cleanupTempDirs removes the CopyCollection temp directories directly in
+// parent, the DB directory when parent is "".
+func (d *Driver) cleanupTempDirs(parent string) (int, error) {
+	if d.singleFile {
+		return 0, nil
+	}
+
+	files, err := d.fs.ReadDir(filepath.Join(d.dir, filepath.FromSlash(parent)))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), d.tempSuffix)
+		if !file.IsDir() || !d.isTemp(file.Name()) || name == "" {
+			continue
+		}
+
+		collection := name
+		if parent != "" {
+			collection = parent + "/" + name
+		}
+
+		mutex, err := d.getOrCreateMutex(collection)
+		if err != nil {
+			return removed, err
+		}
+
+		mutex.Lock()
+		err = d.removeAll(filepath.Join(d.dir, filepath.FromSlash(collection)) + d.tempSuffix)
+		mutex.Unlock()
+
+		if err != nil {
+			return removed, err
+		}
+
+		removed++
+	}
+
+	return removed, nil
+}
+
+func (d *Driver) cleanupCollection(collection string) (int, error) {
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if d.singleFile {
+		return d.cleanupSingle(collection)
+	}
+
+	dir := filepath.Join(d.dir, collection)
+
+	files, err := d.fs.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+
+	for _, file := range files {
+		if file.IsDir() || !d.isTemp(file.Name()) {
+			continue
+		}
+
+		if err := d.fs.Remove(filepath.Join(dir, file.Name())); err != nil {
+			return removed, err
+		}
+
+		removed++
+	}
+
+	return removed, nil
+}
+
+// recoverTempRecord completes the rename of a write that crashed after
+// staging a record, see Options.RecoverTempFiles. It does nothing unless the
+// record is missing and its temp file holds a record that decodes; a temp
+// file that doesn't is left for Cleanup.
+func (d *Driver) recoverTempRecord(mutex *collectionMutex, collection, resource string) error {
+	record := d.recordPath(collection, resource)
+	tmpPath := record + d.tempSuffix
+
+	if _, err := d.fs.Stat(tmpPath); err != nil {
+		return nil
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if _, err := d.fs.Stat(record); !os.IsNotExist(err) {
+		return nil
+	}
+
+	b, err := d.readFile(tmpPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		d.log.Warn("Not recovering '%s': %s", tmpPath, err)
+		return nil
+	}
+
+	var v interface{}
+
+	if _, data := d.splitEnvelope(b); d.codecFor(collection).Unmarshal(data, &v) != nil {
+		d.log.Warn("Not recovering '%s': it doesn't hold a valid record", tmpPath)
+		return nil
+	}
+
+	if err := d.commitRecord(tmpPath, record); err != nil {
+		return ioError(err)
+	}
+
+	if err := d.syncDir(filepath.Dir(record)); err != nil {
+		return ioError(err)
+	}
+
+	d.log.Info("Recovered '%s' in '%s' from its temp file", resource, collection)
+
+	d.updateIndexes(collection, resource)
+	d.addToBloom(collection, resource)
+	d.publish(OpWrite, collection, resource)
+
+	return nil
+}
+
+// VerifyReport is the result of Verify, keyed by collection name.
+type VerifyReport struct {
+	Collections map[string]CollectionReport
+}
+
+// CollectionReport describes the health of one collection.
+type CollectionReport struct {
+	// Records is the number of record files checked and Valid how many of
+	// them decoded.
+	Records int
+	Valid   int
+
+	// Corrupt names the resources whose file could not be read or decoded,
+	// or in SingleFile mode the collection's file if it doesn't decode.
+	Corrupt []string
+
+	// TempFiles lists leftover temp files, see Cleanup.
+	TempFiles []string
+}
+
+// OK reports whether Verify found neither corrupt records nor temp files.
+func (r VerifyReport) OK() bool {
+	for _, c := range r.Collections {
+		if len(c.Corrupt) > 0 || len(c.TempFiles) > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Verify reads and decodes every record of every collection, nested ones
+// included, each under its collection's read lock, and reports the ones
+// that fail along with any leftover temp files. Corrupt records are
+// reported, not returned as errors; the error is only set if a collection
+// could not be scanned at all.
+func (d *Driver) Verify() (VerifyReport, error) {
+	report := VerifyReport{Collections: make(map[string]CollectionReport)}
+
+	collections, err := d.allCollections()
+	if err != nil {
+		return report, err
+	}
+
+	for _, collection := range collections {
+		c, err := d.verifyCollection(collection)
+		if err != nil {
+			return report, err
+		}
+
+		report.Collections[collection] = c
+	}
+
+	return report, nil
+}
+
+func (d *Driver) verifyCollection(collection string) (CollectionReport, error) {
+	var report CollectionReport
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return report, err
+	}
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	if d.singleFile {
+		return d.verifySingle(collection)
+	}
+
+	files, err := d.fs.ReadDir(filepath.Join(d.dir, collection))
+	if err != nil {
+		return report, err
+	}
+
+	for _, file := range files {
+		if !file.IsDir() && d.isTemp(file.Name()) {
+			report.TempFiles = append(report.TempFiles, file.Name())
+		}
+	}
+
+	resources, scan, err := d.scanCollection(collection)
+	if err != nil {
+		return report, err
+	}
+
+	for _, resource := range resources {
+		b, err := scan.read(resource)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		report.Records++
+
+		if err == nil {
+			err = d.checkRecord(collection, b)
+		}
+
+		if err != nil {
+			d.log.Warn("Corrupt record '%s' in '%s': %s", resource, collection, err)
+			report.Corrupt = append(report.Corrupt, resource)
+			continue
+		}
+
+		report.Valid++
+	}
+
+	return report, nil
+}
+
+// checkRecord reports whether b decodes with the codec. For JSON decoding
+// into a json.RawMessage is enough to validate it.
+func (d *Driver) checkRecord(collection string, b []byte) error {
+	codec := d.codecFor(collection)
+
+	if _, ok := codec.(JSONCodec); ok {
+		var raw json.RawMessage
+		return json.Unmarshal(b, &raw)
+	}
+
+	var v interface{}
+
+	return codec.Unmarshal(b, &v)
+}
+
+// DiffReport is the result of Diff. Each list holds resource names in
+// sorted order.
+type DiffReport struct {
+	OnlyInA []string
+	OnlyInB []string
+
+	// Changed names the resources present in both collections whose
+	// records differ.
+	Changed []string
+}
+
+// Equal reports whether Diff found the collections to hold the same records.
+func (r DiffReport) Equal() bool {
+	return len(r.OnlyInA) == 0 && len(r.OnlyInB) == 0 && len(r.Changed) == 0
+}
+
+// Diff compares two collections, with both read-locked, for example a
+// collection and its copy from CopyCollection. JSON records are compared in
+// canonical form, compacted with sorted keys, so formatting and key order
+// don't count as changes; records of other codecs are compared byte for
+// byte.
+func (d *Driver) Diff(collectionA, collectionB string) (DiffReport, error) {
+	var report DiffReport
+
+	if collectionA == "" || collectionB == "" {
+		return report, fmt.Errorf("%w - unable to diff", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collectionA, collectionB); err != nil {
+		return report, err
+	}
+
+	unlock, err := d.lockCollections(false, collectionA, collectionB)
+	if err != nil {
+		return report, err
+	}
+	defer unlock()
+
+	a, err := d.canonicalRecords(collectionA)
+	if err != nil {
+		return report, err
+	}
+
+	b, err := d.canonicalRecords(collectionB)
+	if err != nil {
+		return report, err
+	}
+
+	for resource, ra := range a {
+		rb, ok := b[resource]
+		switch {
+		case !ok:
+			report.OnlyInA = append(report.OnlyInA, resource)
+		case !bytes.Equal(ra, rb):
+			report.Changed = append(report.Changed, resource)
+		}
+	}
+
+	for resource := range b {
+		if _, ok := a[resource]; !ok {
+			report.OnlyInB = append(report.OnlyInB, resource)
+		}
+	}
+
+	sort.Strings(report.OnlyInA)
+	sort.Strings(report.OnlyInB)
+	sort.Strings(report.Changed)
+
+	return report, nil
+}
+
+// canonicalRecords reads every record of a collection in canonical form,
+// keyed by resource. Callers must hold the collection's lock.
+func (d *Driver) canonicalRecords(collection string) (map[string][]byte, error) {
+	resources, scan, err := d.scanCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string][]byte, len(resources))
+
+	for _, resource := range resources {
+		b, err := scan.read(resource)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read '%s' in '%s': %w", resource, collection, err)
+		}
+
+		records[resource] = canonicalJSON(b)
+	}
+
+	return records, nil
+}
+
+// canonicalJSON re-marshals JSON with sorted keys and no whitespace. Bytes
+// that aren't JSON are returned unchanged.
+func canonicalJSON(b []byte) []byte {
+	var v interface{}
+	if err := DecodeWithNumbers(b, &v); err != nil {
+		return b
+	}
+
+	c, err := json.Marshal(v)
+	if err != nil {
+		return b
+	}
+
+	return c
+}
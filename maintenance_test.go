@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCleanupRemovesTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	tmpPath := filepath.Join(dir, "users", "Ghost.json.temp")
+	if err := os.WriteFile(tmpPath, []byte(`{"Name": "Gh`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := d.Cleanup()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Fatalf("Cleanup removed %d files, want 1", n)
+	}
+
+	if _, err := os.Stat(tmpPath); !os.IsNotExist(err) {
+		t.Fatalf("temp file still there after Cleanup: %v", err)
+	}
+
+	if count, err := d.Count("users"); err != nil || count != len(sampleUsers) {
+		t.Fatalf("Count after Cleanup = %d, %v, want %d", count, err, len(sampleUsers))
+	}
+}
+
+func TestCleanupRemovesCopyTempDirs(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, nil)
+
+	writeSampleUsers(t, d, "users")
+	writeSampleUsers(t, d, "teams/a")
+
+	// What a CopyCollection to "backup" and to "teams/b" leaves behind when
+	// the process dies before renaming the copies into place.
+	stale := []string{
+		filepath.Join(dir, "backup.temp"),
+		filepath.Join(dir, "teams", "b.temp"),
+	}
+
+	for _, tmpDir := range stale {
+		if err := os.MkdirAll(tmpDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filepath.Join(tmpDir, "Mrinal.json"), []byte(`{}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	collections, err := d.Collections()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(collections, []string{"teams", "users"}) {
+		t.Fatalf("Collections = %v, want [teams users]", collections)
+	}
+
+	n, err := d.Cleanup()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != len(stale) {
+		t.Fatalf("Cleanup removed %d, want %d", n, len(stale))
+	}
+
+	for _, tmpDir := range stale {
+		if _, err := os.Stat(tmpDir); !os.IsNotExist(err) {
+			t.Fatalf("%s still there after Cleanup: %v", tmpDir, err)
+		}
+	}
+
+	if err := d.CopyCollection("users", "backup"); err != nil {
+		t.Fatal(err)
+	}
+
+	if count, err := d.Count("backup"); err != nil || count != len(sampleUsers) {
+		t.Fatalf("Count of the copy = %d, %v, want %d", count, err, len(sampleUsers))
+	}
+}
+
+func TestMaintenanceCoversNestedCollections(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, nil)
+
+	writeSampleUsers(t, d, "users/active")
+
+	nested := filepath.Join(dir, "users", "active")
+
+	if err := os.WriteFile(filepath.Join(nested, "Broken.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(nested, "Ghost.json.temp"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := d.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := report.Collections["users/active"]
+	if c.Records != len(sampleUsers)+1 || len(c.Corrupt) != 1 || len(c.TempFiles) != 1 {
+		t.Fatalf("Verify reported %+v for users/active", c)
+	}
+
+	if n, err := d.Cleanup(); err != nil || n != 1 {
+		t.Fatalf("Cleanup = %d, %v, want 1", n, err)
+	}
+}
+
+func TestVerifyReportsCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	report, err := d.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !report.OK() {
+		t.Fatalf("Verify of a healthy DB reported %+v", report)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "users", "Broken.json"), []byte(`{"Name": `), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = d.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := report.Collections["users"]
+
+	if report.OK() || c.Records != 4 || c.Valid != 3 || len(c.Corrupt) != 1 || c.Corrupt[0] != "Broken" {
+		t.Fatalf("Verify reported %+v", c)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	if err := d.CopyCollection("users", "users_backup"); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := d.Diff("users", "users_backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !report.Equal() {
+		t.Fatalf("Diff of a fresh copy = %+v, want equal", report)
+	}
+
+	changed := sampleUsers[1]
+	changed.Company = "Jio"
+
+	if err := d.Write("users_backup", changed.Name, changed); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("users_backup", "Someone", User{Name: "Someone"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if report, err = d.Diff("users", "users_backup"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := DiffReport{OnlyInB: []string{"Someone"}, Changed: []string{"Utkarsh"}}
+	if !reflect.DeepEqual(report, want) {
+		t.Fatalf("Diff = %+v, want %+v", report, want)
+	}
+}
+
+func TestRecoverTempFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	staged, err := json.Marshal(sampleUsers[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stage := func() (string, string) {
+		record := filepath.Join(dir, "users", "Utkarsh.json")
+		ghost := filepath.Join(dir, "users", "Ghost.json.temp")
+
+		if err := os.WriteFile(record+".temp", staged, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(ghost, []byte(`{"Name": "Gh`), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		return record, ghost
+	}
+
+	var user User
+
+	// Without the option the staged write stays lost.
+	d := openTestDriver(t, dir, nil)
+	if err := d.Write("users", "Mrinal", sampleUsers[0]); err != nil {
+		t.Fatal(err)
+	}
+	stage()
+	if err := d.Read("users", "Utkarsh", &user); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("Read without RecoverTempFiles = %v, want ErrRecordNotFound", err)
+	}
+	d.Close()
+
+	d = openTestDriver(t, dir, &Options{RecoverTempFiles: true})
+	record, ghost := stage()
+
+	if err := d.Read("users", "Utkarsh", &user); err != nil {
+		t.Fatal(err)
+	}
+
+	if user != sampleUsers[1] {
+		t.Fatalf("recovered %+v, want %+v", user, sampleUsers[1])
+	}
+
+	if _, err := os.Stat(record); err != nil {
+		t.Fatalf("recovered record wasn't renamed into place: %s", err)
+	}
+
+	if _, err := os.Stat(record + ".temp"); !os.IsNotExist(err) {
+		t.Fatalf("temp file still there after recovery: %v", err)
+	}
+
+	if err := d.Read("users", "Ghost", &user); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("Read of a truncated temp file = %v, want ErrRecordNotFound", err)
+	}
+
+	if _, err := os.Stat(ghost); err != nil {
+		t.Fatalf("truncated temp file wasn't left for Cleanup: %s", err)
+	}
+}
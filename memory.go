@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// MemoryStore is a Store that keeps records in memory, encoded the same way
+// the Driver writes them to disk.
+type MemoryStore struct {
+	rwMutex     sync.RWMutex
+	collections map[string]*memoryCollection
+	codec       Codec
+}
+
+type memoryCollection struct {
+	mutex   sync.RWMutex
+	records map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		collections: make(map[string]*memoryCollection),
+		// Decode like a Driver with default Options, see Options.UseNumber.
+		codec: JSONCodec{UseNumber: true},
+	}
+}
+
+func (m *MemoryStore) Write(collection, resource string, v interface{}) error {
+	if collection == "" {
+		return fmt.Errorf("%w - No place to save", ErrEmptyCollection)
+	}
+
+	if resource == "" {
+		return fmt.Errorf("%w - unable to save record (no name)", ErrEmptyResource)
+	}
+
+	if err := checkNames(defaultTempSuffix, collection, resource); err != nil {
+		return err
+	}
+
+	b, err := m.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	c := m.getOrCreateCollection(collection)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.records[resource] = b
+
+	return nil
+}
+
+func (m *MemoryStore) Read(collection, resource string, v interface{}) error {
+	if collection == "" {
+		return fmt.Errorf("%w - unable to read record", ErrEmptyCollection)
+	}
+
+	if resource == "" {
+		return fmt.Errorf("%w - unable to read record (no name)", ErrEmptyResource)
+	}
+
+	if err := checkNames(defaultTempSuffix, collection, resource); err != nil {
+		return err
+	}
+
+	c := m.getCollection(collection)
+	if c == nil {
+		return fmt.Errorf("%w: '%s' in '%s'", ErrRecordNotFound, resource, collection)
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	b, ok := c.records[resource]
+	if !ok {
+		return fmt.Errorf("%w: '%s' in '%s'", ErrRecordNotFound, resource, collection)
+	}
+
+	return m.codec.Unmarshal(b, v)
+}
+
+func (m *MemoryStore) ReadAll(collection string) ([]string, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("%w - unable to read", ErrEmptyCollection)
+	}
+
+	if err := checkNames(defaultTempSuffix, collection); err != nil {
+		return nil, err
+	}
+
+	c := m.getCollection(collection)
+	if c == nil {
+		return nil, fmt.Errorf("%w: '%s'", ErrCollectionNotFound, collection)
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	resources := make([]string, 0, len(c.records))
+
+	for resource := range c.records {
+		resources = append(resources, resource)
+	}
+
+	sort.Strings(resources)
+
+	var records []string
+
+	for _, resource := range resources {
+		records = append(records, string(c.records[resource]))
+	}
+
+	return records, nil
+}
+
+func (m *MemoryStore) Delete(collection, resource string) error {
+	if collection == "" {
+		return fmt.Errorf("%w - unable to delete", ErrEmptyCollection)
+	}
+
+	if resource == "" {
+		return fmt.Errorf("%w - unable to delete record (no name)", ErrEmptyResource)
+	}
+
+	if err := checkNames(defaultTempSuffix, collection, resource); err != nil {
+		return err
+	}
+
+	c := m.getCollection(collection)
+	if c == nil {
+		return fmt.Errorf("%w: '%s' in '%s'", ErrRecordNotFound, resource, collection)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.records[resource]; !ok {
+		return fmt.Errorf("%w: '%s' in '%s'", ErrRecordNotFound, resource, collection)
+	}
+
+	delete(c.records, resource)
+
+	return nil
+}
+
+func (m *MemoryStore) getCollection(collection string) *memoryCollection {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+
+	return m.collections[collection]
+}
+
+func (m *MemoryStore) getOrCreateCollection(collection string) *memoryCollection {
+	m.rwMutex.Lock()
+	defer m.rwMutex.Unlock()
+
+	c, ok := m.collections[collection]
+
+	if !ok {
+		c = &memoryCollection{records: make(map[string][]byte)}
+		m.collections[collection] = c
+	}
+
+	return c
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Meta holds the bookkeeping stored alongside a record when
+// Options.Timestamps is enabled.
+type Meta struct {
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// envelopeVersion is written as "_v" in every envelope. Envelopes written
+// before it was introduced have no "_v"; ones written by a newer version may
+// carry a "_meta" this one can't decode, which is then dropped.
+const envelopeVersion = 1
+
+type envelope struct {
+	Version int         `json:"_v"`
+	Meta    Meta        `json:"_meta"`
+	Data    interface{} `json:"data"`
+}
+
+// splitEnvelope separates a stored record into its metadata and data. Only
+// Options.Timestamps writes envelopes, so without it records are returned
+// unchanged and a user's own object is never mistaken for one. With it, an
+// object holding a numeric "_v" and a "data" is an envelope, whatever other
+// keys a newer version added to it, and so is one holding exactly "_meta"
+// and "data" as written before "_v". Records written before Timestamps was
+// turned on come back unchanged with a nil Meta. Metadata that is missing or
+// can't be decoded, as from a newer envelope version, is dropped, also
+// leaving a nil Meta.
+func (d *Driver) splitEnvelope(b []byte) (*Meta, []byte) {
+	if !d.timestamps || !bytes.Contains(b, []byte(`"data"`)) {
+		return nil, b
+	}
+
+	var fields map[string]json.RawMessage
+
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, b
+	}
+
+	data, ok := fields["data"]
+	if !ok {
+		return nil, b
+	}
+
+	if v, versioned := fields["_v"]; versioned {
+		var version float64
+		if err := json.Unmarshal(v, &version); err != nil {
+			return nil, b
+		}
+	} else if _, ok := fields["_meta"]; !ok || len(fields) != 2 {
+		return nil, b
+	}
+
+	var meta Meta
+
+	if err := json.Unmarshal(fields["_meta"], &meta); err != nil {
+		return nil, data
+	}
+
+	return &meta, data
+}
+
+// stamp wraps v in an envelope, keeping the creation time of the record
+// already stored at path, if any.
+func (d *Driver) stamp(path string, v interface{}) interface{} {
+	now := time.Now().UTC()
+	meta := Meta{CreatedAt: now, UpdatedAt: now}
+
+	if b, err := d.readFile(path); err == nil {
+		if existing, _ := d.splitEnvelope(b); existing != nil {
+			meta.CreatedAt = existing.CreatedAt
+		}
+	}
+
+	return envelope{Version: envelopeVersion, Meta: meta, Data: v}
+}
+
+// ReadMeta returns the timestamps stored with a record. Records written
+// without Options.Timestamps, and every record while it is off, have a zero
+// Meta.
+func (d *Driver) ReadMeta(collection, resource string) (Meta, error) {
+	if collection == "" {
+		return Meta{}, fmt.Errorf("%w - unable to read metadata", ErrEmptyCollection)
+	}
+
+	if resource == "" {
+		return Meta{}, fmt.Errorf("%w - unable to read metadata (no name)", ErrEmptyResource)
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return Meta{}, err
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return Meta{}, err
+	}
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	if d.singleFile {
+		// Timestamps is rejected in SingleFile mode, so there is no Meta.
+		if err := d.statRecord(d.recordPath(collection, resource)); err != nil {
+			if os.IsNotExist(err) {
+				return Meta{}, fmt.Errorf("%w: '%s' in '%s'", ErrRecordNotFound, resource, collection)
+			}
+			return Meta{}, err
+		}
+
+		return Meta{}, nil
+	}
+
+	b, err := d.readFile(d.recordPath(collection, resource))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Meta{}, fmt.Errorf("%w: '%s' in '%s'", ErrRecordNotFound, resource, collection)
+		}
+		return Meta{}, err
+	}
+
+	meta, _ := d.splitEnvelope(b)
+	if meta == nil {
+		return Meta{}, nil
+	}
+
+	return *meta, nil
+}
+
+// LastModified returns the modification time of a record's file, which is
+// when it was last written. Unlike ReadMeta it needs no Options.Timestamps
+// and doesn't read the record. In SingleFile mode it is the time the
+// collection's file was last written, by a change to any of its records.
+func (d *Driver) LastModified(collection, resource string) (time.Time, error) {
+	if collection == "" {
+		return time.Time{}, fmt.Errorf("%w - unable to stat record", ErrEmptyCollection)
+	}
+
+	if resource == "" {
+		return time.Time{}, fmt.Errorf("%w - unable to stat record (no name)", ErrEmptyResource)
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return time.Time{}, err
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	path := d.recordPath(collection, resource)
+
+	if d.singleFile {
+		if err := d.statRecord(path); err != nil {
+			if os.IsNotExist(err) {
+				return time.Time{}, fmt.Errorf("%w: '%s' in '%s'", ErrRecordNotFound, resource, collection)
+			}
+			return time.Time{}, err
+		}
+
+		path = d.collectionFile(collection)
+	}
+
+	fi, err := d.fs.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return time.Time{}, fmt.Errorf("%w: '%s' in '%s'", ErrRecordNotFound, resource, collection)
+		}
+		return time.Time{}, err
+	}
+
+	return fi.ModTime(), nil
+}
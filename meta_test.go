@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLastModified(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	// File systems may store mtimes at a coarser resolution than the clock.
+	before := time.Now().Add(-2 * time.Second)
+
+	if err := d.Write("users", "Mrinal", sampleUsers[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	modified, err := d.LastModified("users", "Mrinal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if modified.Before(before) || modified.After(time.Now().Add(2*time.Second)) {
+		t.Fatalf("LastModified = %s, want about %s", modified, time.Now())
+	}
+
+	if _, err := d.LastModified("users", "Nobody"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("LastModified of a missing record = %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestReadLegacyAndWrappedRecords(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(dir, "users"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	legacy, err := json.Marshal(sampleUsers[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unversioned, err := json.Marshal(map[string]interface{}{"_meta": Meta{}, "data": sampleUsers[2]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for resource, b := range map[string][]byte{"Utkarsh": legacy, "Prachi": unversioned} {
+		if err := os.WriteFile(filepath.Join(dir, "users", resource+".json"), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := openTestDriver(t, dir, &Options{Timestamps: true})
+
+	if err := d.Write("users", "Mrinal", sampleUsers[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	var wrapped map[string]json.RawMessage
+
+	b, err := os.ReadFile(filepath.Join(dir, "users", "Mrinal.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal(b, &wrapped); err != nil || string(wrapped["_v"]) != "1" {
+		t.Fatalf("written record isn't a versioned envelope: %s", b)
+	}
+
+	for _, want := range sampleUsers {
+		var got User
+		if err := d.Read("users", want.Name, &got); err != nil {
+			t.Fatal(err)
+		}
+
+		if got != want {
+			t.Fatalf("Read %s = %+v, want %+v", want.Name, got, want)
+		}
+	}
+
+	records, err := d.ReadAll("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := strings.Join(userNames(t, records), ","), "Mrinal,Prachi,Utkarsh"; got != want {
+		t.Fatalf("ReadAll returned %s, want %s", got, want)
+	}
+
+	if meta, err := d.ReadMeta("users", "Mrinal"); err != nil || meta.CreatedAt.IsZero() {
+		t.Fatalf("ReadMeta of a wrapped record = %+v, %v", meta, err)
+	}
+
+	if meta, err := d.ReadMeta("users", "Utkarsh"); err != nil || meta != (Meta{}) {
+		t.Fatalf("ReadMeta of a legacy record = %+v, %v, want a zero Meta", meta, err)
+	}
+}
+
+func TestEnvelopeLookalikeWithoutTimestamps(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	lookalike := map[string]interface{}{"_v": 1, "_meta": map[string]string{}, "data": "mine"}
+
+	if err := d.Write("things", "x", lookalike); err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]interface{}
+	if err := d.Read("things", "x", &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 3 || got["data"] != "mine" {
+		t.Fatalf("Read = %v, want the object unchanged", got)
+	}
+}
+
+func TestReadNewerEnvelope(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(dir, "users"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	newer, err := json.Marshal(map[string]interface{}{
+		"_v":        envelopeVersion + 1,
+		"_meta":     map[string]interface{}{"created_at": 1},
+		"_checksum": "abc",
+		"data":      sampleUsers[0],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "users", "Mrinal.json"), newer, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := openTestDriver(t, dir, &Options{Timestamps: true})
+
+	var got User
+	if err := d.Read("users", "Mrinal", &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got != sampleUsers[0] {
+		t.Fatalf("Read = %+v, want %+v", got, sampleUsers[0])
+	}
+
+	if meta, err := d.ReadMeta("users", "Mrinal"); err != nil || meta != (Meta{}) {
+		t.Fatalf("ReadMeta of an undecodable _meta = %+v, %v, want a zero Meta", meta, err)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import "time"
+
+// Metrics receives the latency and outcome of the Driver's basic record
+// operations: Read, ReadAll, Delete, and Write, which also covers WriteRaw,
+// Update and WriteBatch. Other operations, such as Query, ReadPage,
+// Transaction and Rename, are not reported. Implement it to export them to
+// a monitoring system such as Prometheus.
+type Metrics interface {
+	ObserveRead(dur time.Duration, err error)
+	ObserveReadAll(dur time.Duration, err error)
+	ObserveWrite(dur time.Duration, err error)
+	ObserveDelete(dur time.Duration, err error)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveRead(time.Duration, error)    {}
+func (noopMetrics) ObserveReadAll(time.Duration, error) {}
+func (noopMetrics) ObserveWrite(time.Duration, error)   {}
+func (noopMetrics) ObserveDelete(time.Duration, error)  {}
+
+// observe reports an operation started at start, and logs a warning if it
+// took longer than Options.SlowThreshold. It is meant to be deferred with a
+// pointer to the operation's named error result.
+func (d *Driver) observe(fn func(time.Duration, error), op, collection string, start time.Time, err *error) {
+	elapsed := time.Since(start)
+
+	fn(elapsed, *err)
+
+	if d.slowThreshold > 0 && elapsed > d.slowThreshold {
+		d.log.Warn("Slow %s on '%s' took %s", op, collection, elapsed)
+	}
+}
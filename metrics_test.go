@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowOperationWarning(t *testing.T) {
+	log := &testLogger{}
+	d := newTestDriver(t, &Options{Logger: log, SlowThreshold: time.Nanosecond})
+
+	writeSampleUsers(t, d, "users")
+
+	if _, err := d.ReadAll("users"); err != nil {
+		t.Fatal(err)
+	}
+
+	var found bool
+	for _, warning := range log.Warnings() {
+		if strings.HasPrefix(warning, "Slow ReadAll on 'users' took ") {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatalf("no slow ReadAll warning among %q", log.Warnings())
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Migrate rewrites every record of a collection with the result of
+// transform, holding the collection's write lock throughout, and returns how
+// many records were rewritten or deleted. A nil result deletes the record.
+// A result equal to the input, ignoring whitespace, leaves the record
+// untouched, so a migration that stopped half way can simply be run again.
+// The first error from transform stops the migration.
+func (d *Driver) Migrate(collection string, transform func(raw json.RawMessage) (json.RawMessage, error)) (int, error) {
+	if collection == "" {
+		return 0, fmt.Errorf("%w - unable to migrate", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return 0, err
+	}
+
+	if d.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	return d.migrate(collection, transform, nil)
+}
+
+// migrate runs a migration. With a report it only records the changes in
+// it, and the caller may hold just the read lock; otherwise callers must
+// hold the collection's write lock.
+func (d *Driver) migrate(collection string, transform func(raw json.RawMessage) (json.RawMessage, error), report *DryRunReport) (int, error) {
+	resources, scan, err := d.scanCollection(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+
+	for _, resource := range resources {
+		raw, err := scan.read(resource)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return migrated, err
+		}
+
+		out, err := transform(raw)
+		if err != nil {
+			return migrated, fmt.Errorf("unable to migrate '%s' in '%s': %w", resource, collection, err)
+		}
+
+		switch {
+		case out == nil:
+			if report != nil {
+				report.Deleted = append(report.Deleted, resource)
+			} else if err := d.deleteRecord(collection, resource); err != nil {
+				return migrated, err
+			}
+		case bytes.Equal(normalize(out), normalize(raw)):
+			continue
+		default:
+			if report != nil {
+				if _, err := d.marshalRecord(collection, out); err != nil {
+					return migrated, err
+				}
+				report.Written = append(report.Written, resource)
+			} else if err := d.writeRecord(collection, resource, out); err != nil {
+				return migrated, err
+			}
+		}
+
+		migrated++
+	}
+
+	return migrated, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMigrateRenamesField(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	renamePincode := func(raw json.RawMessage) (json.RawMessage, error) {
+		var user map[string]interface{}
+		if err := DecodeWithNumbers(raw, &user); err != nil {
+			return nil, err
+		}
+
+		address := user["Address"].(map[string]interface{})
+
+		pincode, ok := address["Pincode"]
+		if !ok {
+			return raw, nil
+		}
+
+		delete(address, "Pincode")
+		address["PostalCode"] = pincode
+
+		return json.Marshal(user)
+	}
+
+	n, err := d.Migrate("users", renamePincode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != len(sampleUsers) {
+		t.Fatalf("Migrate migrated %d records, want %d", n, len(sampleUsers))
+	}
+
+	for _, want := range sampleUsers {
+		fields, err := d.ReadMap("users", want.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		address := fields["Address"].(map[string]interface{})
+
+		if _, ok := address["Pincode"]; ok || address["PostalCode"] != want.Address.Pincode {
+			t.Fatalf("migrated address of %s = %v", want.Name, address)
+		}
+	}
+
+	// Running it again finds nothing left to change.
+	if n, err := d.Migrate("users", renamePincode); err != nil || n != 0 {
+		t.Fatalf("second Migrate = %d, %v, want 0", n, err)
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Rename changes the resource name of a record within its collection. It
+// fails with ErrRecordNotFound if oldResource doesn't exist and with
+// ErrRecordExists if newResource already does.
+func (d *Driver) Rename(collection, oldResource, newResource string) error {
+	if collection == "" {
+		return fmt.Errorf("%w - unable to rename record", ErrEmptyCollection)
+	}
+
+	if oldResource == "" || newResource == "" {
+		return fmt.Errorf("%w - unable to rename record (no name)", ErrEmptyResource)
+	}
+
+	if err := d.validateNames(collection, oldResource, newResource); err != nil {
+		return err
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	return d.moveRecord(collection, oldResource, collection, newResource)
+}
+
+// Rekey renames a record like Rename while rewriting its content with
+// patch, typically to update an embedded key field to match the new name.
+// patch receives the stored record and returns the one to store under
+// newResource; if it fails, nothing changes. The whole operation runs under
+// the collection's write lock, and the record keeps its expiry, if any.
+func (d *Driver) Rekey(collection, oldResource, newResource string, patch func(raw json.RawMessage) (json.RawMessage, error)) error {
+	if collection == "" {
+		return fmt.Errorf("%w - unable to rekey record", ErrEmptyCollection)
+	}
+
+	if oldResource == "" || newResource == "" {
+		return fmt.Errorf("%w - unable to rekey record (no name)", ErrEmptyResource)
+	}
+
+	if err := d.validateNames(collection, oldResource, newResource); err != nil {
+		return err
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	src := d.recordPath(collection, oldResource)
+	dst := d.recordPath(collection, newResource)
+
+	raw, err := d.readRecord(src)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: '%s' in '%s'", ErrRecordNotFound, oldResource, collection)
+		}
+		return err
+	}
+
+	if oldResource != newResource {
+		if err := d.statRecord(dst); err == nil {
+			return fmt.Errorf("%w: '%s' in '%s'", ErrRecordExists, newResource, collection)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	patched, err := patch(raw)
+	if err != nil {
+		return err
+	}
+
+	if err := d.putRecord(collection, newResource, patched); err != nil {
+		return err
+	}
+
+	if oldResource == newResource {
+		return ioError(d.syncDir(d.recordDir(collection)))
+	}
+
+	if err := d.moveFile(d.expiryPath(src), d.expiryPath(dst)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := d.deleteRecord(collection, oldResource); err != nil {
+		return err
+	}
+
+	return ioError(d.syncDir(d.recordDir(collection)))
+}
+
+// MoveCollection moves a record to another collection, possibly under a new
+// resource name. Both collection locks are taken in name order so concurrent
+// moves in opposite directions can't deadlock.
+func (d *Driver) MoveCollection(srcCollection, srcResource, dstCollection, dstResource string) error {
+	if srcCollection == "" || dstCollection == "" {
+		return fmt.Errorf("%w - unable to move record", ErrEmptyCollection)
+	}
+
+	if srcResource == "" || dstResource == "" {
+		return fmt.Errorf("%w - unable to move record (no name)", ErrEmptyResource)
+	}
+
+	if err := d.validateNames(srcCollection, srcResource); err != nil {
+		return err
+	}
+
+	if err := d.validateNames(dstCollection, dstResource); err != nil {
+		return err
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	unlock, err := d.lockCollections(true, srcCollection, dstCollection)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := d.checkCollection(dstCollection); err != nil {
+		return err
+	}
+
+	if !d.singleFile {
+		if err := d.fs.MkdirAll(filepath.Join(d.dir, dstCollection), d.dirMode); err != nil {
+			return err
+		}
+	}
+
+	return d.moveRecord(srcCollection, srcResource, dstCollection, dstResource)
+}
+
+// moveRecord moves a record file, and its expiry if it has one. Callers must
+// hold the write locks of both collections.
+func (d *Driver) moveRecord(srcCollection, srcResource, dstCollection, dstResource string) error {
+	if err := d.checkSameFormat(srcCollection, dstCollection); err != nil {
+		return err
+	}
+
+	src := d.recordPath(srcCollection, srcResource)
+	dst := d.recordPath(dstCollection, dstResource)
+
+	if err := d.statRecord(src); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: '%s' in '%s'", ErrRecordNotFound, srcResource, srcCollection)
+		}
+		return err
+	}
+
+	if err := d.statRecord(dst); err == nil {
+		return fmt.Errorf("%w: '%s' in '%s'", ErrRecordExists, dstResource, dstCollection)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if d.singleFile {
+		return d.moveSingle(srcCollection, srcResource, dstCollection, dstResource)
+	}
+
+	d.cache.remove(src)
+	d.cache.remove(dst)
+
+	if err := d.moveFile(src, dst); err != nil {
+		return err
+	}
+
+	d.updateIndexes(srcCollection, srcResource)
+	d.updateIndexes(dstCollection, dstResource)
+
+	d.publish(OpDelete, srcCollection, srcResource)
+	d.addToBloom(dstCollection, dstResource)
+	d.publish(OpWrite, dstCollection, dstResource)
+
+	if err := d.moveFile(d.expiryPath(src), d.expiryPath(dst)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Both renames are only durable once the two directories are synced.
+	if err := d.syncDir(d.recordDir(srcCollection)); err != nil {
+		return ioError(err)
+	}
+
+	if srcCollection == dstCollection {
+		return nil
+	}
+
+	return ioError(d.syncDir(d.recordDir(dstCollection)))
+}
+
+// moveFile renames src to dst, falling back to copy and delete when they
+// are on different filesystems.
+func (d *Driver) moveFile(src, dst string) error {
+	err := d.fs.Rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	if err := d.copyFile(src, dst); err != nil {
+		return err
+	}
+
+	return d.fs.Remove(src)
+}
+
+// copyFile copies src to dst through a temp file, so dst is either complete
+// or absent.
+func (d *Driver) copyFile(src, dst string) error {
+	b, err := d.fs.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := dst + d.tempSuffix
+
+	if err := d.writeFile(tmpPath, b); err != nil {
+		d.fs.Remove(tmpPath)
+		return err
+	}
+
+	return d.fs.Rename(tmpPath, dst)
+}
+
+// CopyCollection duplicates the collection src under the new name dst,
+// including record expiries, its sequence counter and its indexes but not
+// its trash. It fails with ErrCollectionExists if dst already exists. The
+// copy is assembled in a temp directory and renamed into place, so dst
+// never appears half-copied.
+func (d *Driver) CopyCollection(src, dst string) error {
+	if src == "" || dst == "" {
+		return fmt.Errorf("%w - unable to copy", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(src); err != nil {
+		return err
+	}
+
+	if err := d.validateNames(dst); err != nil {
+		return err
+	}
+
+	if src == dst {
+		return fmt.Errorf("%w: '%s'", ErrCollectionExists, dst)
+	}
+
+	if err := d.checkSameFormat(src, dst); err != nil {
+		return err
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	srcMutex, err := d.getOrCreateMutex(src)
+	if err != nil {
+		return err
+	}
+
+	dstMutex, err := d.getOrCreateMutex(dst)
+	if err != nil {
+		return err
+	}
+
+	// Take the two locks in name order, like lockCollections.
+	if src < dst {
+		srcMutex.RLock()
+		dstMutex.Lock()
+	} else {
+		dstMutex.Lock()
+		srcMutex.RLock()
+	}
+	defer srcMutex.RUnlock()
+	defer dstMutex.Unlock()
+
+	if d.singleFile {
+		return d.copySingle(src, dst)
+	}
+
+	srcDir := filepath.Join(d.dir, src)
+	dstDir := filepath.Join(d.dir, dst)
+
+	if _, err := d.fs.Stat(srcDir); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: '%s'", ErrCollectionNotFound, src)
+		}
+		return err
+	}
+
+	if _, err := d.fs.Stat(dstDir); err == nil {
+		return fmt.Errorf("%w: '%s'", ErrCollectionExists, dst)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	tmpDir := dstDir + d.tempSuffix
+
+	if err := d.removeAll(tmpDir); err != nil {
+		return err
+	}
+
+	if err := d.copyDir(srcDir, tmpDir); err != nil {
+		d.removeAll(tmpDir)
+		return err
+	}
+
+	if err := d.copyDir(filepath.Join(srcDir, indexDir), filepath.Join(tmpDir, indexDir)); err != nil && !os.IsNotExist(err) {
+		d.removeAll(tmpDir)
+		return err
+	}
+
+	d.resetBloom(dst)
+
+	if err := d.fs.Rename(tmpDir, dstDir); err != nil {
+		d.removeAll(tmpDir)
+		return err
+	}
+
+	return d.syncDir(filepath.Dir(dstDir))
+}
+
+// copyDir copies the regular files of src, other than temp files, into a
+// new directory dst. Subdirectories are skipped.
+func (d *Driver) copyDir(src, dst string) error {
+	files, err := d.fs.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	if err := d.fs.MkdirAll(dst, d.dirMode); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || d.isTemp(file.Name()) {
+			continue
+		}
+
+		if err := d.copyFile(filepath.Join(src, file.Name()), filepath.Join(dst, file.Name())); err != nil {
+			return err
+		}
+	}
+
+	return d.syncDir(dst)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRename(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	if err := d.Rename("users", "Mrinal", "Mrinaal"); err != nil {
+		t.Fatal(err)
+	}
+
+	var user User
+	if err := d.Read("users", "Mrinaal", &user); err != nil {
+		t.Fatal(err)
+	}
+
+	if user != sampleUsers[0] {
+		t.Fatalf("renamed record = %+v, want %+v", user, sampleUsers[0])
+	}
+
+	if err := d.Read("users", "Mrinal", &user); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("Read of the old name = %v, want ErrRecordNotFound", err)
+	}
+
+	if err := d.Rename("users", "Mrinal", "Someone"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("Rename of a missing record = %v, want ErrRecordNotFound", err)
+	}
+
+	if err := d.Rename("users", "Mrinaal", "Prachi"); !errors.Is(err, ErrRecordExists) {
+		t.Fatalf("Rename onto an existing record = %v, want ErrRecordExists", err)
+	}
+
+	if err := d.Read("users", "Prachi", &user); err != nil || user != sampleUsers[2] {
+		t.Fatalf("Rename onto an existing record changed it: %+v, %v", user, err)
+	}
+}
+
+func TestMoveCollection(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	if err := d.MoveCollection("users", "Utkarsh", "former", "Utkarsh"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := d.Exists("users", "Utkarsh"); err != nil || ok {
+		t.Fatalf("Exists in the source = %v, %v, want false", ok, err)
+	}
+
+	var user User
+	if err := d.Read("former", "Utkarsh", &user); err != nil {
+		t.Fatal(err)
+	}
+
+	if user != sampleUsers[1] {
+		t.Fatalf("moved record = %+v, want %+v", user, sampleUsers[1])
+	}
+}
+
+// syncLogFS records the directories synced through it.
+type syncLogFS struct {
+	osFS
+
+	mu     sync.Mutex
+	synced []string
+}
+
+func (fs *syncLogFS) SyncDir(dir string) error {
+	fs.mu.Lock()
+	fs.synced = append(fs.synced, dir)
+	fs.mu.Unlock()
+
+	return fs.osFS.SyncDir(dir)
+}
+
+func TestMoveCollectionSyncsBothDirectories(t *testing.T) {
+	dir := t.TempDir()
+	fs := &syncLogFS{}
+	d := openTestDriver(t, dir, &Options{FS: fs})
+
+	writeSampleUsers(t, d, "users")
+
+	if err := d.WriteWithTTL("users", "Guest", User{Name: "Guest"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, resource := range []string{"Utkarsh", "Guest"} {
+		fs.mu.Lock()
+		fs.synced = nil
+		fs.mu.Unlock()
+
+		if err := d.MoveCollection("users", resource, "former", resource); err != nil {
+			t.Fatal(err)
+		}
+
+		fs.mu.Lock()
+		synced := strings.Join(fs.synced, ",")
+		fs.mu.Unlock()
+
+		for _, want := range []string{filepath.Join(dir, "users"), filepath.Join(dir, "former")} {
+			if !strings.Contains(","+synced+",", ","+want+",") {
+				t.Fatalf("moving %s synced [%s], want %s among them", resource, synced, want)
+			}
+		}
+	}
+}
+
+func TestCopyCollection(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	if err := d.CopyCollection("users", "users_backup"); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := d.ReadAll("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := d.ReadAll("users_backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dst) != len(src) {
+		t.Fatalf("copy has %d records, want %d", len(dst), len(src))
+	}
+
+	for _, user := range sampleUsers {
+		var copied User
+		if err := d.Read("users_backup", user.Name, &copied); err != nil {
+			t.Fatal(err)
+		}
+
+		if copied != user {
+			t.Fatalf("copied %s = %+v, want %+v", user.Name, copied, user)
+		}
+	}
+
+	if err := d.CopyCollection("users", "users_backup"); !errors.Is(err, ErrCollectionExists) {
+		t.Fatalf("CopyCollection onto an existing collection = %v, want ErrCollectionExists", err)
+	}
+}
+
+func TestRekey(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	setName := func(name string) func(json.RawMessage) (json.RawMessage, error) {
+		return func(raw json.RawMessage) (json.RawMessage, error) {
+			var user User
+			if err := json.Unmarshal(raw, &user); err != nil {
+				return nil, err
+			}
+
+			user.Name = name
+
+			return json.Marshal(user)
+		}
+	}
+
+	if err := d.Rekey("users", "Mrinal", "Mrinaal", setName("Mrinaal")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "users", "Mrinaal.json")); err != nil {
+		t.Fatalf("renamed file: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "users", "Mrinal.json")); !os.IsNotExist(err) {
+		t.Fatalf("old file still there: %v", err)
+	}
+
+	want := sampleUsers[0]
+	want.Name = "Mrinaal"
+
+	var user User
+	if err := d.Read("users", "Mrinaal", &user); err != nil || user != want {
+		t.Fatalf("Read = %+v, %v, want %+v", user, err, want)
+	}
+
+	failed := errors.New("patch failed")
+
+	if err := d.Rekey("users", "Utkarsh", "Utkarsh2", func(json.RawMessage) (json.RawMessage, error) { return nil, failed }); err != failed {
+		t.Fatalf("Rekey with a failing patch = %v, want %v", err, failed)
+	}
+
+	if ok, err := d.Exists("users", "Utkarsh2"); err != nil || ok {
+		t.Fatalf("failed Rekey created the new record: %v, %v", ok, err)
+	}
+
+	if err := d.Read("users", "Utkarsh", &user); err != nil || user != sampleUsers[1] {
+		t.Fatalf("failed Rekey changed the old record: %+v, %v", user, err)
+	}
+
+	if err := d.Rekey("users", "Utkarsh", "Prachi", setName("Prachi")); !errors.Is(err, ErrRecordExists) {
+		t.Fatalf("Rekey onto an existing record = %v, want ErrRecordExists", err)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+const mutexShards = 32
+
+// mutexTable maps collection names to their mutexes. It is split into
+// shards, each with its own lock, so that looking up the mutexes of
+// different collections doesn't contend on a single lock. The zero value is
+// ready to use.
+type mutexTable struct {
+	shards [mutexShards]mutexShard
+}
+
+type mutexShard struct {
+	mu      sync.RWMutex
+	mutexes map[string]*tableMutex
+
+	// frozen is set while lockAll holds the table, see freeze. New entries
+	// aren't created until it is closed.
+	frozen chan struct{}
+}
+
+// tableMutex is an entry of the table. evicted is only written with the
+// mutex held for writing and only read with it held, so whoever locks an
+// entry can tell whether it was removed in the meantime.
+type tableMutex struct {
+	sync.RWMutex
+	evicted bool
+}
+
+// collectionMutex is the lock of one collection, as returned by
+// getOrCreateMutex. Its Lock and RLock only return once they hold the
+// entry currently in the table: if the entry they looked up was removed
+// before they got it, they look the collection up again. Two callers can
+// therefore never hold different mutexes for the same collection.
+type collectionMutex struct {
+	table      *mutexTable
+	collection string
+	m          *tableMutex
+}
+
+func (c *collectionMutex) Lock() {
+	for {
+		c.m.Lock()
+		if !c.m.evicted {
+			return
+		}
+		c.m.Unlock()
+		c.m = c.table.getOrCreate(c.collection)
+	}
+}
+
+func (c *collectionMutex) Unlock() {
+	c.m.Unlock()
+}
+
+func (c *collectionMutex) RLock() {
+	for {
+		c.m.RLock()
+		if !c.m.evicted {
+			return
+		}
+		c.m.RUnlock()
+		c.m = c.table.getOrCreate(c.collection)
+	}
+}
+
+func (c *collectionMutex) RUnlock() {
+	c.m.RUnlock()
+}
+
+func (t *mutexTable) shard(collection string) *mutexShard {
+	h := fnv.New32a()
+	h.Write([]byte(collection))
+
+	return &t.shards[h.Sum32()%mutexShards]
+}
+
+// lookup returns a handle on the collection's mutex.
+func (t *mutexTable) lookup(collection string) *collectionMutex {
+	return &collectionMutex{table: t, collection: collection, m: t.getOrCreate(collection)}
+}
+
+// getOrCreate returns the collection's entry, creating it on first use. The
+// same collection always gets the same entry until it is removed. While the
+// table is frozen, creating an entry waits for it to thaw.
+func (t *mutexTable) getOrCreate(collection string) *tableMutex {
+	s := t.shard(collection)
+
+	s.mu.RLock()
+	m, ok := s.mutexes[collection]
+	s.mu.RUnlock()
+
+	if ok {
+		return m
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		if m, ok := s.mutexes[collection]; ok {
+			return m
+		}
+
+		if s.frozen == nil {
+			break
+		}
+
+		frozen := s.frozen
+		s.mu.Unlock()
+		<-frozen
+		s.mu.Lock()
+	}
+
+	if s.mutexes == nil {
+		s.mutexes = make(map[string]*tableMutex)
+	}
+
+	m = &tableMutex{}
+	s.mutexes[collection] = m
+
+	return m
+}
+
+// remove forgets the collection's mutex if it is still the one c holds and
+// nobody else is holding or waiting for it, and reports whether it did. c
+// must not be locked.
+func (t *mutexTable) remove(c *collectionMutex) bool {
+	s := t.shard(c.collection)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.mutexes[c.collection]
+	if m != c.m || !m.TryLock() {
+		return false
+	}
+
+	m.evicted = true
+	delete(s.mutexes, c.collection)
+	m.Unlock()
+
+	return true
+}
+
+// freeze stops new entries from being created and returns every entry in
+// the table, so that locking them all covers every collection until thaw
+// is called. Entries removed after freeze returns are recreated only after
+// thaw, so a caller retrying a removed entry waits too. The entries are
+// sorted by collection name, the order lockCollections takes locks in.
+func (t *mutexTable) freeze() []*tableMutex {
+	var names []string
+	entries := make(map[string]*tableMutex)
+
+	for i := range t.shards {
+		s := &t.shards[i]
+
+		s.mu.Lock()
+		s.frozen = make(chan struct{})
+		for name, m := range s.mutexes {
+			names = append(names, name)
+			entries[name] = m
+		}
+		s.mu.Unlock()
+	}
+
+	sort.Strings(names)
+
+	mutexes := make([]*tableMutex, len(names))
+	for i, name := range names {
+		mutexes[i] = entries[name]
+	}
+
+	return mutexes
+}
+
+// thaw undoes freeze.
+func (t *mutexTable) thaw() {
+	for i := range t.shards {
+		s := &t.shards[i]
+
+		s.mu.Lock()
+		close(s.frozen)
+		s.frozen = nil
+		s.mu.Unlock()
+	}
+}
+
+func (t *mutexTable) len() int {
+	n := 0
+
+	for i := range t.shards {
+		s := &t.shards[i]
+
+		s.mu.RLock()
+		n += len(s.mutexes)
+		s.mu.RUnlock()
+	}
+
+	return n
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMutexEvictionDoesNotSplitLock(t *testing.T) {
+	var table mutexTable
+
+	early := table.lookup("users")
+
+	if !table.remove(table.lookup("users")) {
+		t.Fatal("remove of an unlocked mutex failed")
+	}
+
+	late := table.lookup("users")
+
+	early.Lock()
+	defer early.Unlock()
+
+	if late.m.TryLock() {
+		t.Fatal("a handle looked up before eviction locked a different mutex than one looked up after")
+	}
+
+	if table.remove(late) {
+		t.Fatal("remove of a held mutex succeeded")
+	}
+}
+
+// BenchmarkGetOrCreateMutexParallel resolves and read-locks the mutexes of
+// many collections from parallel goroutines, the pattern of concurrent
+// reads spread across collections.
+func BenchmarkGetOrCreateMutexParallel(b *testing.B) {
+	d, err := New(b.TempDir(), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer d.Close()
+
+	collections := make([]string, 256)
+	for i := range collections {
+		collections[i] = fmt.Sprintf("c%d", i)
+	}
+
+	var next uint32
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(atomic.AddUint32(&next, 1))
+
+		for pb.Next() {
+			mutex, err := d.getOrCreateMutex(collections[i%len(collections)])
+			if err != nil {
+				b.Error(err)
+				return
+			}
+
+			mutex.RLock()
+			mutex.RUnlock()
+
+			i++
+		}
+	})
+}
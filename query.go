@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Query returns the records of a collection for which predicate returns true.
+func (d *Driver) Query(collection string, predicate func(raw json.RawMessage) (bool, error)) ([]json.RawMessage, error) {
+	var matches []json.RawMessage
+
+	err := d.forEach(context.Background(), collection, func(_ string, raw []byte) error {
+		ok, err := predicate(raw)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			matches = append(matches, raw)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
+
+// ReadPage returns at most limit records of a collection starting at offset.
+// Records are ordered by resource name, so pages are stable across calls as
+// long as the collection isn't modified in between. An offset past the end
+// returns an empty slice.
+func (d *Driver) ReadPage(collection string, offset, limit int) ([]string, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("%w - unable to read", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return nil, err
+	}
+
+	if offset < 0 || limit < 0 {
+		return nil, fmt.Errorf("invalid page offset %d, limit %d", offset, limit)
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	resources, scan, err := d.scanCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []string{}
+
+	if offset >= len(resources) {
+		return records, nil
+	}
+
+	// Compare against the remaining count rather than computing
+	// offset+limit, which overflows for a limit near math.MaxInt.
+	end := len(resources)
+	if limit < end-offset {
+		end = offset + limit
+	}
+
+	for _, resource := range resources[offset:end] {
+		b, err := scan.read(resource)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, string(b))
+	}
+
+	return records, nil
+}
+
+// ReadAllMap returns every record of a collection keyed by resource name.
+func (d *Driver) ReadAllMap(collection string) (map[string]string, error) {
+	records := make(map[string]string)
+
+	err := d.forEach(context.Background(), collection, func(resource string, raw []byte) error {
+		records[resource] = string(raw)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// ReadMany reads several records of a collection under a single read lock
+// and returns them keyed by resource name. Resources that don't exist, or
+// have expired, are left out of the map rather than failing the call.
+func (d *Driver) ReadMany(collection string, resources []string) (map[string]json.RawMessage, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("%w - unable to read", ErrEmptyCollection)
+	}
+
+	for _, resource := range resources {
+		if resource == "" {
+			return nil, fmt.Errorf("%w - unable to read record (no name)", ErrEmptyResource)
+		}
+	}
+
+	if err := d.validateNames(collection, resources...); err != nil {
+		return nil, err
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	records := make(map[string]json.RawMessage, len(resources))
+
+	for _, resource := range resources {
+		record := d.recordPath(collection, resource)
+
+		if d.isExpired(record) {
+			continue
+		}
+
+		if b, ok := d.cache.get(record); ok {
+			records[resource] = append(json.RawMessage(nil), b...)
+			continue
+		}
+
+		b, err := d.readRecord(record)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read '%s' in '%s': %w", resource, collection, err)
+		}
+
+		d.cache.add(record, b)
+		records[resource] = append(json.RawMessage(nil), b...)
+	}
+
+	return records, nil
+}
+
+// ReadGlob returns the records of a collection whose resource name matches
+// pattern, using filepath.Match syntax, keyed by resource name. Only the
+// matching records are read.
+func (d *Driver) ReadGlob(collection, pattern string) (map[string]json.RawMessage, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("%w - unable to read", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return nil, err
+	}
+
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	resources, scan, err := d.scanCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string]json.RawMessage)
+
+	for _, resource := range resources {
+		if ok, _ := filepath.Match(pattern, resource); !ok {
+			continue
+		}
+
+		b, err := scan.read(resource)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read '%s' in '%s': %w", resource, collection, err)
+		}
+
+		records[resource] = b
+	}
+
+	return records, nil
+}
+
+// DeleteWhere deletes every record of a collection for which predicate
+// returns true and returns how many were removed. Records that can't be read
+// or removed don't stop the scan; their errors are joined and returned.
+func (d *Driver) DeleteWhere(collection string, predicate func(raw json.RawMessage) (bool, error)) (int, error) {
+	if collection == "" {
+		return 0, fmt.Errorf("%w - unable to delete", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return 0, err
+	}
+
+	if d.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	return d.deleteWhere(collection, predicate, nil)
+}
+
+// deleteWhere runs DeleteWhere. With a report it only records the matches
+// in it, and the caller may hold just the read lock; otherwise callers must
+// hold the collection's write lock.
+func (d *Driver) deleteWhere(collection string, predicate func(raw json.RawMessage) (bool, error), report *DryRunReport) (int, error) {
+	resources, scan, err := d.scanCollection(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+
+	var errs []error
+
+	for _, resource := range resources {
+		b, err := scan.read(resource)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to read '%s' in '%s': %w", resource, collection, err))
+			continue
+		}
+
+		ok, err := predicate(b)
+		if err != nil {
+			return deleted, err
+		}
+
+		if !ok {
+			continue
+		}
+
+		if report != nil {
+			report.Deleted = append(report.Deleted, resource)
+		} else if err := d.deleteRecord(collection, resource); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		deleted++
+	}
+
+	return deleted, errors.Join(errs...)
+}
+
+// DeleteMany deletes the listed records of a collection under a single
+// write lock and returns how many were removed. Resources that don't exist
+// are skipped as already gone; other failures don't stop the batch, their
+// errors are joined and returned.
+func (d *Driver) DeleteMany(collection string, resources []string) (int, error) {
+	if collection == "" {
+		return 0, fmt.Errorf("%w - unable to delete", ErrEmptyCollection)
+	}
+
+	for _, resource := range resources {
+		if resource == "" {
+			return 0, fmt.Errorf("%w - unable to delete record (no name)", ErrEmptyResource)
+		}
+	}
+
+	if err := d.validateNames(collection, resources...); err != nil {
+		return 0, err
+	}
+
+	if d.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	deleted := 0
+
+	var errs []error
+
+	for _, resource := range resources {
+		if err := d.deleteRecord(collection, resource); err != nil {
+			if !errors.Is(err, ErrRecordNotFound) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		deleted++
+	}
+
+	return deleted, errors.Join(errs...)
+}
+
+// ReadAllSorted returns the records of a collection ordered by the value of
+// a top-level field. Numbers compare numerically, strings lexically and
+// false before true; values of different kinds are ordered numbers, strings,
+// booleans, then anything else. Records without the field, or where it is
+// null, come last in either direction. Ties keep resource name order.
+func (d *Driver) ReadAllSorted(collection, field string, ascending bool) ([]json.RawMessage, error) {
+	records, err := d.ReadAllRaw(collection)
+	if records == nil {
+		return nil, err
+	}
+
+	keys := make([]interface{}, len(records))
+	for i, raw := range records {
+		keys[i] = sortKey(raw, field)
+	}
+
+	idx := make([]int, len(records))
+	for i := range idx {
+		idx[i] = i
+	}
+
+	sort.SliceStable(idx, func(i, j int) bool {
+		a, b := keys[idx[i]], keys[idx[j]]
+
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+
+		if ascending {
+			return compareValues(a, b) < 0
+		}
+		return compareValues(a, b) > 0
+	})
+
+	sorted := make([]json.RawMessage, len(records))
+	for i, j := range idx {
+		sorted[i] = records[j]
+	}
+
+	return sorted, err
+}
+
+// sortKey returns the value of field in raw, decoding numbers as
+// json.Number so that large integers keep their precision. It returns nil
+// if raw is not an object or the field is missing or null.
+func sortKey(raw json.RawMessage, field string) interface{} {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	var fields map[string]interface{}
+	if err := dec.Decode(&fields); err != nil {
+		return nil
+	}
+
+	return fields[field]
+}
+
+func compareValues(a, b interface{}) int {
+	if ra, rb := kindRank(a), kindRank(b); ra != rb {
+		return ra - rb
+	}
+
+	switch a := a.(type) {
+	case json.Number:
+		x, _ := new(big.Float).SetString(a.String())
+		y, _ := new(big.Float).SetString(b.(json.Number).String())
+		if x == nil || y == nil {
+			return strings.Compare(a.String(), b.(json.Number).String())
+		}
+		return x.Cmp(y)
+	case string:
+		return strings.Compare(a, b.(string))
+	case bool:
+		switch {
+		case a == b.(bool):
+			return 0
+		case !a:
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func kindRank(v interface{}) int {
+	switch v.(type) {
+	case json.Number:
+		return 0
+	case string:
+		return 1
+	case bool:
+		return 2
+	default:
+		return 3
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// rawNames returns the "Name" fields of raw records, sorted.
+func rawNames(t testing.TB, records []json.RawMessage) []string {
+	t.Helper()
+
+	strs := make([]string, len(records))
+	for i, record := range records {
+		strs[i] = string(record)
+	}
+
+	return userNames(t, strs)
+}
+
+func TestQuery(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	matches, err := d.Query("users", func(raw json.RawMessage) (bool, error) {
+		var user User
+		if err := json.Unmarshal(raw, &user); err != nil {
+			return false, err
+		}
+
+		return user.Company == "Aramco", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := strings.Join(rawNames(t, matches), ","), "Mrinal,Prachi"; got != want {
+		t.Fatalf("Query returned %s, want %s", got, want)
+	}
+}
+
+func TestReadAllSortedByAge(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	// "9" sorts after "17" as a string but before it as a number.
+	if err := d.Write("users", "Kid", User{Name: "Kid", Age: "9"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("users", "Ageless", map[string]string{"Name": "Ageless"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		ascending bool
+		want      string
+	}{
+		{true, "Kid,Prachi,Utkarsh,Mrinal,Ageless"},
+		{false, "Mrinal,Utkarsh,Prachi,Kid,Ageless"},
+	} {
+		records, err := d.ReadAllSorted("users", "Age", tc.ascending)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names := make([]string, len(records))
+		for i, record := range records {
+			var user User
+			if err := json.Unmarshal(record, &user); err != nil {
+				t.Fatal(err)
+			}
+			names[i] = user.Name
+		}
+
+		if got := strings.Join(names, ","); got != tc.want {
+			t.Errorf("ReadAllSorted(ascending=%v) = %s, want %s", tc.ascending, got, tc.want)
+		}
+	}
+}
+
+func TestReadMany(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	records, err := d.ReadMany("users", []string{"Mrinal", "Utkarsh", "Nobody", "Prachi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 3 {
+		t.Fatalf("ReadMany returned %d records, want 3", len(records))
+	}
+
+	if _, ok := records["Nobody"]; ok {
+		t.Fatal("ReadMany returned a missing record")
+	}
+
+	for _, want := range sampleUsers {
+		var got User
+		if err := json.Unmarshal(records[want.Name], &got); err != nil || got != want {
+			t.Fatalf("ReadMany[%s] = %s, %v", want.Name, records[want.Name], err)
+		}
+	}
+}
+
+func TestReadGlob(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	for _, resource := range []string{"2023-12-31", "2024-01-01", "2024-02-15", "notes"} {
+		if err := d.Write("logs", resource, map[string]string{"day": resource}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := d.ReadGlob("logs", "2024-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resources := make([]string, 0, len(records))
+	for resource := range records {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+
+	if got, want := strings.Join(resources, ","), "2024-01-01,2024-02-15"; got != want {
+		t.Fatalf("ReadGlob returned %s, want %s", got, want)
+	}
+
+	var day map[string]string
+	if err := json.Unmarshal(records["2024-02-15"], &day); err != nil || day["day"] != "2024-02-15" {
+		t.Fatalf("ReadGlob[2024-02-15] = %s, %v", records["2024-02-15"], err)
+	}
+
+	if _, err := d.ReadGlob("logs", "2024-["); !errors.Is(err, filepath.ErrBadPattern) {
+		t.Fatalf("ReadGlob with an invalid pattern = %v, want filepath.ErrBadPattern", err)
+	}
+}
+
+func TestDeleteMany(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	n, err := d.DeleteMany("users", []string{"Mrinal", "Nobody", "Prachi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Fatalf("DeleteMany removed %d records, want 2", n)
+	}
+
+	records, err := d.ReadAll("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := strings.Join(userNames(t, records), ","), "Utkarsh"; got != want {
+		t.Fatalf("collection holds %s, want %s", got, want)
+	}
+}
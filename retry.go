@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// RetryPolicy controls how the rename that commits a write and the remove
+// that performs a delete are retried when they fail with a transient error,
+// such as a sharing violation on Windows or EAGAIN on a network filesystem.
+// Other errors are returned immediately.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	// Values below 2 disable retrying.
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry. It doubles after each
+	// further attempt.
+	Backoff time.Duration
+}
+
+// do runs fn until it succeeds, fails with a non-transient error, or the
+// policy's attempts are used up.
+func (p RetryPolicy) do(fn func() error) error {
+	delay := p.Backoff
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !isTransient(err) {
+			return err
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func isTransient(err error) bool {
+	for _, target := range transientErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
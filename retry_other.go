@@ -0,0 +1,5 @@
+//go:build !unix && !windows
+
+package main
+
+var transientErrors []error
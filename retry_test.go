@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyFS is the OS filesystem, except that its first failures renames fail
+// with err.
+type flakyFS struct {
+	osFS
+
+	mu       sync.Mutex
+	err      error
+	failures int
+	renames  int
+}
+
+func (fs *flakyFS) Rename(oldpath, newpath string) error {
+	fs.mu.Lock()
+	fs.renames++
+	fail := fs.renames <= fs.failures
+	fs.mu.Unlock()
+
+	if fail {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.err}
+	}
+
+	return fs.osFS.Rename(oldpath, newpath)
+}
+
+func TestRetryTransientRename(t *testing.T) {
+	if len(transientErrors) == 0 {
+		t.Skip("no transient errors are classified on this platform")
+	}
+
+	fs := &flakyFS{err: transientErrors[0], failures: 2}
+	d := newTestDriver(t, &Options{FS: fs, RetryPolicy: RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}})
+
+	if err := d.Write("users", "Mrinal", sampleUsers[0]); err != nil {
+		t.Fatalf("Write with two transient rename failures = %v", err)
+	}
+
+	if fs.renames != 3 {
+		t.Fatalf("rename was attempted %d times, want 3", fs.renames)
+	}
+
+	var user User
+	if err := d.Read("users", "Mrinal", &user); err != nil || user != sampleUsers[0] {
+		t.Fatalf("Read = %+v, %v, want %+v", user, err, sampleUsers[0])
+	}
+
+	fs.renames, fs.failures = 0, 3
+
+	if err := d.Write("users", "Utkarsh", sampleUsers[1]); !errors.Is(err, transientErrors[0]) {
+		t.Fatalf("Write with more failures than attempts = %v, want %v", err, transientErrors[0])
+	}
+}
+
+func TestRetrySkipsPermanentErrors(t *testing.T) {
+	fs := &flakyFS{err: os.ErrPermission, failures: 1}
+	d := newTestDriver(t, &Options{FS: fs, RetryPolicy: RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}})
+
+	if err := d.Write("users", "Mrinal", sampleUsers[0]); !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("Write = %v, want a permission error", err)
+	}
+
+	if fs.renames != 1 {
+		t.Fatalf("rename was attempted %d times, want 1", fs.renames)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+var transientErrors = []error{
+	syscall.EAGAIN,
+	syscall.EBUSY,
+	syscall.EINTR,
+	syscall.ETXTBSY,
+}
@@ -0,0 +1,8 @@
+package main
+
+import "syscall"
+
+var transientErrors = []error{
+	syscall.Errno(32), // ERROR_SHARING_VIOLATION
+	syscall.Errno(33), // ERROR_LOCK_VIOLATION
+}
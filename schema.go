@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schemaFile is the per-collection JSON Schema every written record is
+// checked against, when present.
+const schemaFile = "_schema.json"
+
+// schemaCache keeps each collection's parsed schema along with the mtime and
+// size of the file it came from, so an edited schema is picked up on the next
+// write without re-parsing it every time.
+type schemaCache struct {
+	mu      sync.Mutex
+	schemas map[string]cachedSchema
+}
+
+type cachedSchema struct {
+	modTime time.Time
+	size    int64
+	schema  map[string]interface{}
+}
+
+// checkSchema validates marshalled record bytes against the collection's
+// _schema.json, if it has one. Violations are reported as ErrSchemaViolation
+// naming the offending path, e.g. "$.address.pincode".
+//
+// The supported subset of JSON Schema is type, enum, const, required,
+// properties, additionalProperties, items, minimum, maximum, minLength,
+// maxLength, pattern, minItems and maxItems.
+func (d *Driver) checkSchema(collection string, b []byte) error {
+	schema, err := d.loadSchema(collection)
+	if err != nil || schema == nil {
+		return err
+	}
+
+	var v interface{}
+	if err := DecodeWithNumbers(b, &v); err != nil {
+		return fmt.Errorf("%w: $: record is not JSON: %s", ErrSchemaViolation, err)
+	}
+
+	return validateSchema(schema, v, "$")
+}
+
+func (d *Driver) loadSchema(collection string) (map[string]interface{}, error) {
+	path := filepath.Join(d.dir, collection, schemaFile)
+
+	fi, err := d.fs.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d.schemas.mu.Lock()
+	defer d.schemas.mu.Unlock()
+
+	if c, ok := d.schemas.schemas[collection]; ok && c.modTime.Equal(fi.ModTime()) && c.size == fi.Size() {
+		return c.schema, nil
+	}
+
+	b, err := d.fs.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var schema map[string]interface{}
+	if err := DecodeWithNumbers(b, &schema); err != nil {
+		return nil, fmt.Errorf("invalid schema '%s': %w", path, err)
+	}
+
+	if d.schemas.schemas == nil {
+		d.schemas.schemas = make(map[string]cachedSchema)
+	}
+
+	d.schemas.schemas[collection] = cachedSchema{modTime: fi.ModTime(), size: fi.Size(), schema: schema}
+
+	return schema, nil
+}
+
+func validateSchema(schema map[string]interface{}, v interface{}, path string) error {
+	violation := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s: %s", ErrSchemaViolation, path, fmt.Sprintf(format, args...))
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, v) {
+		return violation("expected type %v, got %s", t, jsonType(v))
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return violation("value is not one of %v", enum)
+		}
+	}
+
+	if c, ok := schema["const"]; ok && !jsonEqual(c, v) {
+		return violation("value must be %v", c)
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, r := range required {
+				if name, ok := r.(string); ok {
+					if _, ok := v[name]; !ok {
+						return fmt.Errorf("%w: %s.%s: required field is missing", ErrSchemaViolation, path, name)
+					}
+				}
+			}
+		}
+
+		properties, _ := schema["properties"].(map[string]interface{})
+
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if sub, ok := properties[name].(map[string]interface{}); ok {
+				if err := validateSchema(sub, v[name], path+"."+name); err != nil {
+					return err
+				}
+				continue
+			}
+
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					return fmt.Errorf("%w: %s.%s: field is not allowed", ErrSchemaViolation, path, name)
+				}
+			case map[string]interface{}:
+				if err := validateSchema(extra, v[name], path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+
+	case []interface{}:
+		if n, ok := schemaNumber(schema, "minItems"); ok && float64(len(v)) < n {
+			return violation("expected at least %v items, got %d", n, len(v))
+		}
+
+		if n, ok := schemaNumber(schema, "maxItems"); ok && float64(len(v)) > n {
+			return violation("expected at most %v items, got %d", n, len(v))
+		}
+
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if err := validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+
+	case string:
+		length := float64(len([]rune(v)))
+
+		if n, ok := schemaNumber(schema, "minLength"); ok && length < n {
+			return violation("expected at least %v characters", n)
+		}
+
+		if n, ok := schemaNumber(schema, "maxLength"); ok && length > n {
+			return violation("expected at most %v characters", n)
+		}
+
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("invalid schema pattern %q at %s: %w", pattern, path, err)
+			}
+			if !re.MatchString(v) {
+				return violation("value does not match pattern %q", pattern)
+			}
+		}
+
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return violation("invalid number %s", v)
+		}
+
+		if n, ok := schemaNumber(schema, "minimum"); ok && f < n {
+			return violation("value %s is less than %v", v, n)
+		}
+
+		if n, ok := schemaNumber(schema, "maximum"); ok && f > n {
+			return violation("value %s is greater than %v", v, n)
+		}
+	}
+
+	return nil
+}
+
+func schemaNumber(schema map[string]interface{}, key string) (float64, bool) {
+	n, ok := schema[key].(json.Number)
+	if !ok {
+		return 0, false
+	}
+
+	f, err := n.Float64()
+
+	return f, err == nil
+}
+
+// matchesType reports whether v has the JSON type t, which is a type name or
+// a list of them.
+func matchesType(t interface{}, v interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		actual := jsonType(v)
+		return actual == t || (t == "number" && actual == "integer")
+	case []interface{}:
+		for _, name := range t {
+			if matchesType(name, v) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			return "number"
+		}
+		return "integer"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func jsonEqual(a, b interface{}) bool {
+	x, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+
+	y, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(normalize(x), normalize(y))
+}
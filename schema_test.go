@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const userSchema = `{
+	"type": "object",
+	"required": ["Name", "Address"],
+	"properties": {
+		"Name": {"type": "string", "minLength": 1},
+		"Address": {
+			"type": "object",
+			"properties": {
+				"Pincode": {"type": "string", "pattern": "^[0-9]{4}$"}
+			}
+		}
+	}
+}`
+
+func TestSchema(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, nil)
+
+	if err := os.MkdirAll(filepath.Join(dir, "users"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "users", schemaFile), []byte(userSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("users", "Mrinal", sampleUsers[0]); err != nil {
+		t.Fatalf("Write of a valid record: %s", err)
+	}
+
+	bad := sampleUsers[1]
+	bad.Address.Pincode = "89a2"
+
+	err := d.Write("users", bad.Name, bad)
+	if !errors.Is(err, ErrSchemaViolation) {
+		t.Fatalf("Write of an invalid record = %v, want ErrSchemaViolation", err)
+	}
+
+	if !strings.Contains(err.Error(), "$.Address.Pincode") {
+		t.Fatalf("error %q doesn't name the failing field", err)
+	}
+
+	if ok, err := d.Exists("users", bad.Name); err != nil || ok {
+		t.Fatalf("Exists of the rejected record = %v, %v, want false", ok, err)
+	}
+
+	records, err := d.ReadAll("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 1 {
+		t.Fatalf("ReadAll returned %d records, want 1 (the schema isn't a record)", len(records))
+	}
+
+	// An edited schema is picked up on the next write.
+	if err := os.WriteFile(filepath.Join(dir, "users", schemaFile), []byte(`{"type": "object"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("users", bad.Name, bad); err != nil {
+		t.Fatalf("Write after relaxing the schema: %s", err)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const seqFile = "_seq"
+
+// Insert writes v under the next integer ID of the collection and returns
+// that ID. IDs are allocated from a _seq file under the collection's write
+// lock, so they are never reused, even across restarts.
+func (d *Driver) Insert(collection string, v interface{}) (string, error) {
+	if collection == "" {
+		return "", fmt.Errorf("%w - No place to save", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return "", err
+	}
+
+	if d.readOnly {
+		return "", ErrReadOnly
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return "", err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	seq, err := d.nextSeq(collection)
+	if err != nil {
+		return "", err
+	}
+
+	id := strconv.FormatUint(seq, 10)
+
+	if err := d.writeRecord(collection, id, v); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// nextSeq increments and persists the collection's sequence counter.
+// Callers must hold the collection's write lock.
+func (d *Driver) nextSeq(collection string) (uint64, error) {
+	if err := d.checkCollection(collection); err != nil {
+		return 0, err
+	}
+
+	dir := filepath.Join(d.dir, collection)
+
+	if err := d.fs.MkdirAll(dir, d.dirMode); err != nil {
+		return 0, err
+	}
+
+	path := filepath.Join(dir, seqFile)
+
+	var seq uint64
+
+	b, err := d.fs.ReadFile(path)
+	switch {
+	case err == nil:
+		if seq, err = strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64); err != nil {
+			return 0, fmt.Errorf("corrupt sequence file '%s': %w", path, err)
+		}
+	case !os.IsNotExist(err):
+		return 0, err
+	}
+
+	seq++
+
+	if err := d.writeFileAtomic(path, []byte(strconv.FormatUint(seq, 10))); err != nil {
+		return 0, err
+	}
+
+	return seq, nil
+}
+
+// seqWidth is wide enough for any uint64, so Append's zero-padded names sort
+// in sequence order.
+const seqWidth = 20
+
+// Append adds v to the end of an append-only log collection and returns its
+// sequence number. Records are named by their zero-padded sequence number,
+// allocated like Insert's IDs, so sequence numbers start at 1 and increase
+// by one per call.
+func (d *Driver) Append(collection string, v interface{}) (uint64, error) {
+	if collection == "" {
+		return 0, fmt.Errorf("%w - No place to save", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return 0, err
+	}
+
+	if d.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	seq, err := d.nextSeq(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := d.writeRecord(collection, fmt.Sprintf("%0*d", seqWidth, seq), v); err != nil {
+		return 0, err
+	}
+
+	return seq, nil
+}
+
+// ReadFrom returns the records of a log collection written by Append with a
+// sequence number of fromSeq or later, in sequence order. Passing the last
+// sequence number seen plus one resumes a stream.
+func (d *Driver) ReadFrom(collection string, fromSeq uint64) ([]json.RawMessage, error) {
+	if collection == "" {
+		return nil, fmt.Errorf("%w - unable to read", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return nil, err
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	resources, scan, err := d.scanCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	from := fmt.Sprintf("%0*d", seqWidth, fromSeq)
+	start := sort.SearchStrings(resources, from)
+
+	var records []json.RawMessage
+
+	for _, resource := range resources[start:] {
+		if len(resource) != seqWidth {
+			continue
+		}
+
+		if _, err := strconv.ParseUint(resource, 10, 64); err != nil {
+			continue
+		}
+
+		b, err := scan.read(resource)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, b)
+	}
+
+	return records, nil
+}
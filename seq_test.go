@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+func TestInsertConcurrentIDsAreUnique(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	const goroutines, inserts = 16, 25
+
+	ids := make(chan string, goroutines*inserts)
+
+	var wg sync.WaitGroup
+
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < inserts; i++ {
+				id, err := d.Insert("events", map[string]int{"i": i})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				ids <- id
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[string]bool)
+
+	for id := range ids {
+		if seen[id] {
+			t.Fatalf("ID %s was returned twice", id)
+		}
+
+		seen[id] = true
+	}
+
+	if len(seen) != goroutines*inserts {
+		t.Fatalf("got %d IDs, want %d", len(seen), goroutines*inserts)
+	}
+
+	if n, err := d.Count("events"); err != nil || n != goroutines*inserts {
+		t.Fatalf("Count = %d, %v, want %d", n, err, goroutines*inserts)
+	}
+}
+
+func TestAppendReadFrom(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	// More than nine events, so that ordering by name would break without
+	// the zero padding.
+	for i := 1; i <= 12; i++ {
+		seq, err := d.Append("events", map[string]int{"n": i})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if seq != uint64(i) {
+			t.Fatalf("Append returned sequence %d, want %d", seq, i)
+		}
+	}
+
+	for _, tc := range []struct {
+		from  uint64
+		first int
+	}{
+		{0, 1},
+		{1, 1},
+		{10, 10},
+		{13, 0},
+	} {
+		records, err := d.ReadFrom("events", tc.from)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := 0
+		if tc.first > 0 {
+			want = 12 - tc.first + 1
+		}
+
+		if len(records) != want {
+			t.Fatalf("ReadFrom(%d) returned %d records, want %d", tc.from, len(records), want)
+		}
+
+		for i, record := range records {
+			var event map[string]int
+			if err := json.Unmarshal(record, &event); err != nil {
+				t.Fatal(err)
+			}
+
+			if event["n"] != tc.first+i {
+				t.Fatalf("ReadFrom(%d)[%d] = %v, want n = %d", tc.from, i, event, tc.first+i)
+			}
+		}
+	}
+}
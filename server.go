@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Server exposes a Driver over a small REST API:
+//
+//	GET    /{collection}             list every record as a JSON array
+//	GET    /{collection}/{resource}  read a record
+//	PUT    /{collection}/{resource}  write the JSON request body
+//	DELETE /{collection}/{resource}  delete a record
+//
+// For nested collections the last path segment is the resource.
+type Server struct {
+	driver *Driver
+}
+
+// maxBodyBytes bounds PUT bodies when the Driver has no
+// Options.MaxRecordBytes, so a client can't make the server buffer an
+// arbitrarily large request.
+const maxBodyBytes = 32 << 20
+
+func NewServer(d *Driver) http.Handler {
+	return &Server{driver: d}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+
+	if path == "" {
+		http.Error(w, "missing collection", http.StatusBadRequest)
+		return
+	}
+
+	i := strings.LastIndex(path, "/")
+
+	if i < 0 {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		s.list(w, path)
+		return
+	}
+
+	collection, resource := path[:i], path[i+1:]
+
+	switch r.Method {
+	case http.MethodGet:
+		s.get(w, collection, resource)
+	case http.MethodPut:
+		s.put(w, r, collection, resource)
+	case http.MethodDelete:
+		s.delete(w, collection, resource)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) list(w http.ResponseWriter, collection string) {
+	records, err := s.driver.ReadAllRaw(collection)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if records == nil {
+		records = []json.RawMessage{}
+	}
+
+	writeJSON(w, http.StatusOK, records)
+}
+
+func (s *Server) get(w http.ResponseWriter, collection, resource string) {
+	var record json.RawMessage
+
+	if err := s.driver.Read(collection, resource, &record); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, record)
+}
+
+func (s *Server) put(w http.ResponseWriter, r *http.Request, collection, resource string) {
+	limit := int64(maxBodyBytes)
+	if s.driver.maxRecordBytes > 0 {
+		limit = s.driver.maxRecordBytes
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !json.Valid(body) {
+		http.Error(w, "request body is not valid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.driver.Write(collection, resource, json.RawMessage(body)); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) delete(w http.ResponseWriter, collection, resource string) {
+	if err := s.driver.Delete(collection, resource); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, ErrRecordNotFound), errors.Is(err, ErrCollectionNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrInvalidName), errors.Is(err, ErrEmptyCollection), errors.Is(err, ErrEmptyResource),
+		errors.Is(err, ErrSchemaViolation):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrRecordTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrReadOnly):
+		status = http.StatusForbidden
+	}
+
+	http.Error(w, err.Error(), status)
+}
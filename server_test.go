@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serve sends a request to a Server over d and returns the recorded
+// response.
+func serve(d *Driver, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	NewServer(d).ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+
+	return w
+}
+
+func TestServer(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if w := serve(d, http.MethodPut, "/users/Mrinal", `{"Name": "Mrinal", "Company": "Aramco"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("PUT = %d %s", w.Code, w.Body)
+	}
+
+	w := serve(d, http.MethodGet, "/users/Mrinal", "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("GET = %d %s", w.Code, w.Body)
+	}
+
+	var user User
+	if err := json.Unmarshal(w.Body.Bytes(), &user); err != nil || user.Company != "Aramco" {
+		t.Fatalf("GET returned %s: %v", w.Body, err)
+	}
+
+	w = serve(d, http.MethodGet, "/users", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET collection = %d %s", w.Code, w.Body)
+	}
+
+	var records []json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &records); err != nil || len(records) != 1 {
+		t.Fatalf("GET collection returned %s: %v", w.Body, err)
+	}
+
+	for _, tc := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPut, "/users/Broken", "{", http.StatusBadRequest},
+		{http.MethodGet, "/users/Nobody", "", http.StatusNotFound},
+		{http.MethodGet, "/missing", "", http.StatusNotFound},
+		{http.MethodGet, "/", "", http.StatusBadRequest},
+		{http.MethodPost, "/users/Mrinal", "{}", http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/users", "", http.StatusMethodNotAllowed},
+		{http.MethodPut, "/users/.hidden", "{}", http.StatusBadRequest},
+	} {
+		if w := serve(d, tc.method, tc.path, tc.body); w.Code != tc.want {
+			t.Errorf("%s %s = %d, want %d", tc.method, tc.path, w.Code, tc.want)
+		}
+	}
+
+	if w := serve(d, http.MethodDelete, "/users/Mrinal", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE = %d %s", w.Code, w.Body)
+	}
+
+	if w := serve(d, http.MethodGet, "/users/Mrinal", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("GET after DELETE = %d, want 404", w.Code)
+	}
+}
+
+func TestServerBodyLimit(t *testing.T) {
+	d := newTestDriver(t, &Options{MaxRecordBytes: 64})
+
+	if w := serve(d, http.MethodPut, "/users/Mrinal", `{"Name": "Mrinal"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("PUT of a small body = %d %s", w.Code, w.Body)
+	}
+
+	body := `{"Name": "` + strings.Repeat("x", 100) + `"}`
+	if w := serve(d, http.MethodPut, "/users/Utkarsh", body); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("PUT of a large body = %d, want 413", w.Code)
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// singleFileExt is the extension of a collection's file in SingleFile mode.
+const singleFileExt = ".json"
+
+var errSingleFile = errors.New("not supported with Options.SingleFile")
+
+// checkSingleFile rejects options that change how record files are stored
+// or rely on records having files of their own, neither of which SingleFile
+// mode has.
+func checkSingleFile(opts Options) error {
+	if _, ok := opts.Codec.(JSONCodec); !ok {
+		return fmt.Errorf("SingleFile requires the JSON codec")
+	}
+
+	switch {
+	case opts.Compress:
+		return fmt.Errorf("Compress is %w", errSingleFile)
+	case opts.EncryptionKey != nil:
+		return fmt.Errorf("EncryptionKey is %w", errSingleFile)
+	case opts.Timestamps:
+		return fmt.Errorf("Timestamps is %w", errSingleFile)
+	case opts.SoftDelete:
+		return fmt.Errorf("SoftDelete is %w", errSingleFile)
+	case opts.WALPath != "":
+		return fmt.Errorf("WALPath is %w", errSingleFile)
+	case opts.StrictCollections:
+		return fmt.Errorf("StrictCollections is %w", errSingleFile)
+	}
+
+	return nil
+}
+
+// collectionFile returns the path of the file holding a collection's
+// records in SingleFile mode.
+func (d *Driver) collectionFile(collection string) string {
+	return filepath.Join(d.dir, collection+singleFileExt)
+}
+
+// recordDir returns the directory a record write renames a file into, which
+// is the one to sync afterwards.
+func (d *Driver) recordDir(collection string) string {
+	if d.singleFile {
+		return filepath.Dir(d.collectionFile(collection))
+	}
+
+	return filepath.Join(d.dir, collection)
+}
+
+// loadCollection reads a collection's file in SingleFile mode. A collection
+// without a file fails with an error satisfying os.IsNotExist.
+func (d *Driver) loadCollection(collection string) (map[string]json.RawMessage, error) {
+	b, err := d.fs.ReadFile(d.collectionFile(collection))
+	if err != nil {
+		return nil, err
+	}
+
+	var records map[string]json.RawMessage
+
+	if err := json.Unmarshal(b, &records); err != nil {
+		return nil, fmt.Errorf("unable to decode '%s': %w", d.collectionFile(collection), err)
+	}
+
+	if records == nil {
+		records = make(map[string]json.RawMessage)
+	}
+
+	return records, nil
+}
+
+// saveCollection replaces a collection's file through a temp file and
+// rename, so readers see either all of a change or none of it. The caller
+// syncs the directory.
+func (d *Driver) saveCollection(collection string, records map[string]json.RawMessage) error {
+	b, err := d.codec.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrMarshal, err)
+	}
+
+	path := d.collectionFile(collection)
+	tmpPath := path + d.tempSuffix
+
+	// A nested collection's file sits in a directory of its own.
+	if err := d.fs.MkdirAll(filepath.Dir(path), d.dirMode); err != nil {
+		return ioError(err)
+	}
+
+	if err := d.writeFile(tmpPath, b); err != nil {
+		d.fs.Remove(tmpPath)
+		return ioError(err)
+	}
+
+	return ioError(d.retry.do(func() error { return d.fs.Rename(tmpPath, path) }))
+}
+
+// storeSingle writes marshalled records into a collection's file in one
+// read-modify-write. Callers must hold the collection's write lock.
+func (d *Driver) storeSingle(collection string, data map[string][]byte) error {
+	records, err := d.loadCollection(collection)
+	if os.IsNotExist(err) {
+		records, err = make(map[string]json.RawMessage), nil
+	}
+	if err != nil {
+		return err
+	}
+
+	changed := false
+
+	for resource, b := range data {
+		if d.skipIdentical && bytes.Equal(normalize(records[resource]), normalize(b)) {
+			continue
+		}
+
+		records[resource] = b
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	if err := d.saveCollection(collection, records); err != nil {
+		return err
+	}
+
+	resources := make([]string, 0, len(data))
+	for resource := range data {
+		resources = append(resources, resource)
+	}
+
+	sort.Strings(resources)
+
+	for _, resource := range resources {
+		d.cache.remove(d.recordPath(collection, resource))
+		d.updateIndexes(collection, resource)
+		d.addToBloom(collection, resource)
+		d.publish(OpWrite, collection, resource)
+	}
+
+	return nil
+}
+
+// readSingle reads the record at path, as returned by recordPath, from its
+// collection's file. A missing record fails with an error satisfying
+// os.IsNotExist, like a missing record file.
+func (d *Driver) readSingle(path string) ([]byte, error) {
+	collection, resource, err := d.splitRecordPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := d.loadCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	b, ok := records[resource]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: path, Err: fs.ErrNotExist}
+	}
+
+	return b, nil
+}
+
+// deleteSingle removes a record from its collection's file. Callers must
+// hold the collection's write lock.
+func (d *Driver) deleteSingle(collection, resource string) error {
+	records, err := d.loadCollection(collection)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if _, ok := records[resource]; !ok {
+		return fmt.Errorf("%w: '%s' in '%s'", ErrRecordNotFound, resource, collection)
+	}
+
+	delete(records, resource)
+
+	if err := d.saveCollection(collection, records); err != nil {
+		return err
+	}
+
+	d.cache.remove(d.recordPath(collection, resource))
+	d.updateIndexes(collection, resource)
+	d.publish(OpDelete, collection, resource)
+
+	return nil
+}
+
+// listSingle returns the resource names in a collection's file, sorted.
+func (d *Driver) listSingle(collection string) ([]string, error) {
+	records, err := d.loadCollection(collection)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: '%s'", ErrCollectionNotFound, collection)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]string, 0, len(records))
+	for resource := range records {
+		resources = append(resources, resource)
+	}
+
+	sort.Strings(resources)
+
+	return resources, nil
+}
+
+// dropSingle removes a collection's file. Callers must hold the
+// collection's write lock.
+func (d *Driver) dropSingle(collection string) error {
+	path := d.collectionFile(collection)
+
+	if err := d.fs.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: '%s'", ErrCollectionNotFound, collection)
+		}
+		return err
+	}
+
+	d.cache.removePrefix(filepath.Join(d.dir, collection) + string(filepath.Separator))
+	d.resetBloom(collection)
+
+	return d.syncDir(d.dir)
+}
+
+// isCollectionFile reports whether a database directory entry is a
+// collection's file in SingleFile mode.
+func (d *Driver) isCollectionFile(file os.DirEntry) bool {
+	name := file.Name()
+
+	return !file.IsDir() && !strings.HasPrefix(name, ".") && !d.isTemp(name) && strings.HasSuffix(name, singleFileExt)
+}
+
+// splitRecordPath recovers the collection and resource a path returned by
+// recordPath belongs to.
+func (d *Driver) splitRecordPath(path string) (collection, resource string, err error) {
+	rel, err := filepath.Rel(d.dir, path)
+	if err != nil {
+		return "", "", err
+	}
+
+	collection = filepath.ToSlash(filepath.Dir(rel))
+	if collection == "." {
+		return "", "", fmt.Errorf("%w: '%s' is not a record path", ErrInvalidName, path)
+	}
+
+	resource, err = d.resourceName(strings.TrimSuffix(filepath.Base(rel), d.format(collection).extension()))
+
+	return collection, resource, err
+}
+
+// statRecord checks that the record at path exists, failing with an error
+// satisfying os.IsNotExist if it doesn't, in either storage mode.
+func (d *Driver) statRecord(path string) error {
+	if d.singleFile {
+		_, err := d.readSingle(path)
+		return err
+	}
+
+	_, err := d.fs.Stat(path)
+
+	return err
+}
+
+// moveSingle moves a record between collection files, or within one, by
+// writing it under its new name before deleting the old one, so a crash in
+// between leaves it duplicated rather than lost. Callers must hold the write
+// locks of both collections and have checked that the move is allowed.
+func (d *Driver) moveSingle(srcCollection, srcResource, dstCollection, dstResource string) error {
+	raw, err := d.readSingle(d.recordPath(srcCollection, srcResource))
+	if err != nil {
+		return err
+	}
+
+	if err := d.storeSingle(dstCollection, map[string][]byte{dstResource: raw}); err != nil {
+		return err
+	}
+
+	if err := d.deleteSingle(srcCollection, srcResource); err != nil {
+		return err
+	}
+
+	return ioError(d.syncDir(d.dir))
+}
+
+// copySingle implements CopyCollection in SingleFile mode. Callers must
+// hold src's lock and dst's write lock.
+func (d *Driver) copySingle(src, dst string) error {
+	records, err := d.loadCollection(src)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: '%s'", ErrCollectionNotFound, src)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := d.fs.Stat(d.collectionFile(dst)); err == nil {
+		return fmt.Errorf("%w: '%s'", ErrCollectionExists, dst)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := d.saveCollection(dst, records); err != nil {
+		return err
+	}
+
+	d.resetBloom(dst)
+
+	return d.syncDir(d.dir)
+}
+
+// cleanupSingle removes the temp file of an interrupted write of a
+// collection's file. Callers must hold the collection's write lock.
+func (d *Driver) cleanupSingle(collection string) (int, error) {
+	err := d.fs.Remove(d.collectionFile(collection) + d.tempSuffix)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return 1, nil
+}
+
+// verifySingle implements Verify for one collection file. A file that can't
+// be decoded is reported as a single corrupt entry named after the file,
+// since its records can't be told apart. Callers must hold the collection's
+// lock.
+func (d *Driver) verifySingle(collection string) (CollectionReport, error) {
+	var report CollectionReport
+
+	path := d.collectionFile(collection)
+
+	if _, err := d.fs.Stat(path + d.tempSuffix); err == nil {
+		report.TempFiles = append(report.TempFiles, filepath.Base(path+d.tempSuffix))
+	}
+
+	records, err := d.loadCollection(collection)
+	if os.IsNotExist(err) {
+		return report, fmt.Errorf("%w: '%s'", ErrCollectionNotFound, collection)
+	}
+	if err != nil {
+		d.log.Warn("Corrupt collection file '%s': %s", path, err)
+		report.Records = 1
+		report.Corrupt = append(report.Corrupt, filepath.Base(path))
+		return report, nil
+	}
+
+	resources := make([]string, 0, len(records))
+	for resource := range records {
+		resources = append(resources, resource)
+	}
+
+	sort.Strings(resources)
+
+	for _, resource := range resources {
+		report.Records++
+
+		if err := d.checkRecord(collection, records[resource]); err != nil {
+			d.log.Warn("Corrupt record '%s' in '%s': %s", resource, collection, err)
+			report.Corrupt = append(report.Corrupt, resource)
+			continue
+		}
+
+		report.Valid++
+	}
+
+	return report, nil
+}
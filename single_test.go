@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// crudScript runs the same operations against a Driver and returns what
+// each reported, so two storage modes can be compared.
+func crudScript(t *testing.T, d *Driver) []string {
+	t.Helper()
+
+	var log []string
+
+	record := func(op string, v ...interface{}) {
+		log = append(log, op+": "+fmt.Sprint(v...))
+	}
+
+	readAll := func(collection string) {
+		records, err := d.ReadAll(collection)
+		record("ReadAll "+collection, strings.Join(userNames(t, records), ","), " ", err)
+	}
+
+	writeSampleUsers(t, d, "users")
+	readAll("users")
+
+	var user User
+	err := d.Read("users", "Utkarsh", &user)
+	record("Read", user, err)
+
+	changed := sampleUsers[1]
+	changed.Company = "Jio"
+	record("Write", d.Write("users", changed.Name, changed))
+	err = d.Read("users", "Utkarsh", &user)
+	record("Read after overwrite", user, err)
+
+	record("Delete", d.Delete("users", "Prachi"))
+	record("Delete again", d.Delete("users", "Prachi"))
+	ok, err := d.Exists("users", "Prachi")
+	record("Exists", ok, err)
+
+	record("Rename", d.Rename("users", "Mrinal", "Mrinaal"))
+	record("Rename onto existing", d.Rename("users", "Mrinaal", "Utkarsh"))
+	record("Rekey", d.Rekey("users", "Mrinaal", "Mrinal", func(raw json.RawMessage) (json.RawMessage, error) { return raw, nil }))
+	record("Rekey onto existing", d.Rekey("users", "Mrinal", "Utkarsh", func(raw json.RawMessage) (json.RawMessage, error) { return raw, nil }))
+	readAll("users")
+
+	record("MoveCollection", d.MoveCollection("users", "Utkarsh", "former", "Utkarsh"))
+	readAll("former")
+
+	stats, err := d.Stats("users")
+	record("Stats", stats.RecordCount, err)
+
+	record("CopyCollection", d.CopyCollection("users", "users_backup"))
+	readAll("users_backup")
+
+	writeSampleUsers(t, d, "users/staff")
+	readAll("users/staff")
+
+	report, err := d.Verify()
+	record("Verify", report.OK(), len(report.Collections), err)
+
+	collections, err := d.Collections()
+	record("Collections", collections, err)
+
+	record("DropCollection", d.DropCollection("former"))
+	_, err = d.ReadAll("former")
+	record("ReadAll dropped", err)
+
+	return log
+}
+
+func TestSingleFileMatchesMultiFile(t *testing.T) {
+	multi := crudScript(t, newTestDriver(t, nil))
+
+	dir := t.TempDir()
+	single := crudScript(t, openTestDriver(t, dir, &Options{SingleFile: true}))
+
+	if !reflect.DeepEqual(single, multi) {
+		for i := range multi {
+			if i >= len(single) || single[i] != multi[i] {
+				t.Errorf("multi-file:  %s", multi[i])
+				if i < len(single) {
+					t.Errorf("single file: %s", single[i])
+				}
+			}
+		}
+		t.Fatal("SingleFile mode behaves differently")
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records map[string]User
+	if err := json.Unmarshal(b, &records); err != nil {
+		t.Fatalf("collection file isn't an object of records: %s", err)
+	}
+
+	if len(records) != 1 || records["Mrinal"] != sampleUsers[0] {
+		t.Fatalf("collection file holds %v", records)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "users", "staff.json")); err != nil {
+		t.Fatalf("nested collection file: %s", err)
+	}
+}
+
+func TestSingleFileScansLoadTheFileOnce(t *testing.T) {
+	loads := 0
+
+	d := newTestDriver(t, &Options{SingleFile: true, FS: hookFS{onRead: func(name string) {
+		if filepath.Base(name) == "users.json" {
+			loads++
+		}
+	}}})
+
+	for i := 0; i < 50; i++ {
+		if err := d.Write("users", fmt.Sprint("user-", i), User{Name: fmt.Sprint("user-", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, scan := range map[string]func() error{
+		"ReadAll":  func() error { _, err := d.ReadAll("users"); return err },
+		"ReadPage": func() error { _, err := d.ReadPage("users", 10, 30); return err },
+		"ReadGlob": func() error { _, err := d.ReadGlob("users", "user-1*"); return err },
+		"Stats":    func() error { _, err := d.Stats("users"); return err },
+		"Verify":   func() error { _, err := d.Verify(); return err },
+		"DeleteWhereDryRun": func() error {
+			_, err := d.DeleteWhereDryRun("users", func(json.RawMessage) (bool, error) { return true, nil })
+			return err
+		},
+	} {
+		loads = 0
+
+		if err := scan(); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if loads != 1 {
+			t.Errorf("%s loaded the collection file %d times, want once", name, loads)
+		}
+	}
+}
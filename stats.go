@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+)
+
+// CollectionStats describes the on-disk footprint of a collection.
+type CollectionStats struct {
+	RecordCount        int
+	TotalBytes         int64
+	LargestRecordBytes int64
+	LargestResource    string
+}
+
+// Stats reports the record count and storage usage of a collection. It only
+// stats record files and never reads their contents.
+func (d *Driver) Stats(collection string) (CollectionStats, error) {
+	if collection == "" {
+		return CollectionStats{}, fmt.Errorf("%w - unable to stat", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return CollectionStats{}, err
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return CollectionStats{}, err
+	}
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	resources, scan, err := d.scanCollection(collection)
+	if err != nil {
+		return CollectionStats{}, err
+	}
+
+	var stats CollectionStats
+
+	for _, resource := range resources {
+		size, err := scan.size(resource)
+		if err != nil {
+			return CollectionStats{}, err
+		}
+
+		stats.RecordCount++
+		stats.TotalBytes += size
+
+		if size > stats.LargestRecordBytes {
+			stats.LargestRecordBytes = size
+			stats.LargestResource = resource
+		}
+	}
+
+	return stats, nil
+}
+
+// DriverStats describes the in-memory state of a Driver.
+type DriverStats struct {
+	// Mutexes is the number of collection mutexes currently held in memory.
+	Mutexes int
+
+	// Watchers is the number of open Watch channels across all collections.
+	Watchers int
+
+	// CacheEntries and CacheBytes are the number and total size of records
+	// in the read cache. CacheHits and CacheMisses count lookups since New.
+	// All four are zero when Options.CacheSize is not set.
+	CacheEntries int
+	CacheBytes   int64
+	CacheHits    uint64
+	CacheMisses  uint64
+}
+
+// DriverStats reports the Driver's in-memory footprint, e.g. for spotting
+// mutexes that are never released.
+func (d *Driver) DriverStats() DriverStats {
+	var stats DriverStats
+
+	stats.Mutexes = d.mutexes.len()
+
+	d.watchers.mu.Lock()
+	for _, chans := range d.watchers.chans {
+		stats.Watchers += len(chans)
+	}
+	d.watchers.mu.Unlock()
+
+	stats.CacheEntries, stats.CacheBytes, stats.CacheHits, stats.CacheMisses = d.cache.stats()
+
+	return stats
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStatsLargestRecord(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	for resource, size := range map[string]int{"small": 10, "large": 1000, "medium": 100} {
+		if err := d.Write("blobs", resource, map[string]string{"data": strings.Repeat("x", size)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := d.Stats("blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.RecordCount != 3 {
+		t.Errorf("RecordCount = %d, want 3", stats.RecordCount)
+	}
+
+	if stats.LargestResource != "large" {
+		t.Errorf("LargestResource = %q, want %q", stats.LargestResource, "large")
+	}
+
+	if stats.LargestRecordBytes <= 1000 || stats.TotalBytes <= stats.LargestRecordBytes {
+		t.Errorf("LargestRecordBytes = %d, TotalBytes = %d", stats.LargestRecordBytes, stats.TotalBytes)
+	}
+}
+
+func TestDriverStats(t *testing.T) {
+	d := newTestDriver(t, &Options{CacheSize: 10})
+
+	collections := []string{"accounts", "audit", "ledger", "staff", "users"}
+
+	for i, collection := range collections {
+		writeSampleUsers(t, d, collection)
+
+		if got := d.DriverStats().Mutexes; got != i+1 {
+			t.Fatalf("Mutexes after writing to %d collections = %d", i+1, got)
+		}
+	}
+
+	// Using a collection again doesn't add a mutex.
+	writeSampleUsers(t, d, "users")
+
+	if got := d.DriverStats().Mutexes; got != len(collections) {
+		t.Fatalf("Mutexes after reusing a collection = %d, want %d", got, len(collections))
+	}
+
+	for _, collection := range []string{"audit", "ledger"} {
+		if err := d.DropCollection(collection); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := d.DriverStats().Mutexes; got != len(collections)-2 {
+		t.Fatalf("Mutexes after dropping 2 collections = %d, want %d", got, len(collections)-2)
+	}
+
+	_, cancel, err := d.Watch("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := d.DriverStats().Watchers; got != 1 {
+		t.Fatalf("Watchers = %d, want 1", got)
+	}
+
+	cancel()
+
+	if got := d.DriverStats().Watchers; got != 0 {
+		t.Fatalf("Watchers after cancelling = %d, want 0", got)
+	}
+
+	var user User
+	for i := 0; i < 2; i++ {
+		if err := d.Read("users", "Mrinal", &user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stats := d.DriverStats(); stats.CacheHits == 0 || stats.CacheEntries == 0 || stats.CacheBytes == 0 {
+		t.Fatalf("cache stats after a repeated Read = %+v", stats)
+	}
+}
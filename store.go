@@ -0,0 +1,16 @@
+package main
+
+// Store is the core record API shared by the on-disk Driver and the
+// in-memory MemoryStore, so code can depend on it and swap in MemoryStore
+// for tests.
+type Store interface {
+	Write(collection, resource string, v interface{}) error
+	Read(collection, resource string, v interface{}) error
+	ReadAll(collection string) ([]string, error)
+	Delete(collection, resource string) error
+}
+
+var (
+	_ Store = (*Driver)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
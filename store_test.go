@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStoreBehaviour(t *testing.T) {
+	for name, newStore := range map[string]func(t *testing.T) Store{
+		"Driver":      func(t *testing.T) Store { return newTestDriver(t, nil) },
+		"MemoryStore": func(t *testing.T) Store { return NewMemoryStore() },
+	} {
+		t.Run(name, func(t *testing.T) {
+			testStore(t, newStore(t))
+		})
+	}
+}
+
+// testStore is the behaviour every Store must share.
+func testStore(t *testing.T, s Store) {
+	for _, user := range sampleUsers {
+		if err := s.Write("users", user.Name, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var user User
+	if err := s.Read("users", "Utkarsh", &user); err != nil || user != sampleUsers[1] {
+		t.Fatalf("Read = %+v, %v, want %+v", user, err, sampleUsers[1])
+	}
+
+	records, err := s.ReadAll("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := strings.Join(userNames(t, records), ","), "Mrinal,Prachi,Utkarsh"; got != want {
+		t.Fatalf("ReadAll returned %s, want %s", got, want)
+	}
+
+	var fields map[string]interface{}
+	if err := s.Write("numbers", "big", map[string]int64{"n": 12345678901234567}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Read("numbers", "big", &fields); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fields["n"]; got != json.Number("12345678901234567") {
+		t.Fatalf("large integer read back as %v (%T)", got, got)
+	}
+
+	if err := s.Delete("users", "Utkarsh"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Read("users", "Utkarsh", &user); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("Read after Delete = %v, want ErrRecordNotFound", err)
+	}
+
+	if err := s.Delete("users", "Utkarsh"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("second Delete = %v, want ErrRecordNotFound", err)
+	}
+
+	if _, err := s.ReadAll("missing"); !errors.Is(err, ErrCollectionNotFound) {
+		t.Fatalf("ReadAll of a missing collection = %v, want ErrCollectionNotFound", err)
+	}
+
+	if err := s.Write("", "x", 1); !errors.Is(err, ErrEmptyCollection) {
+		t.Fatalf("Write without a collection = %v, want ErrEmptyCollection", err)
+	}
+
+	if err := s.Write("users", "../x", 1); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("Write of an invalid name = %v, want ErrInvalidName", err)
+	}
+}
+
+func TestUseNumberOff(t *testing.T) {
+	off := false
+	d := newTestDriver(t, &Options{UseNumber: &off})
+
+	if err := d.Write("numbers", "big", map[string]int64{"n": 12345678901234567}); err != nil {
+		t.Fatal(err)
+	}
+
+	var fields map[string]interface{}
+	if err := d.Read("numbers", "big", &fields); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := fields["n"].(float64); !ok {
+		t.Fatalf("number read back as %T, want float64 with UseNumber off", fields["n"])
+	}
+}
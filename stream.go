@@ -0,0 +1,237 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+)
+
+// WriteRaw stores the JSON document read from r as a record, byte for byte
+// unless Options.Timestamps wraps it in an envelope. r must hold exactly one
+// JSON value; anything else fails with ErrMarshal and leaves the record
+// untouched. It requires the JSON codec.
+//
+// The document is validated as it is copied to the temp file, so large
+// records aren't held in memory. That is unless something needs the whole
+// record: encryption, Options.Timestamps, a Validator, SkipIdenticalWrites
+// or a collection schema, or an FS that can't stream files. WriteRaw then
+// reads r fully and checks the record like Write does.
+func (d *Driver) WriteRaw(collection, resource string, r io.Reader) (err error) {
+	defer d.observe(d.metrics.ObserveWrite, "WriteRaw", collection, time.Now(), &err)
+
+	if collection == "" {
+		return fmt.Errorf("%w - No place to save", ErrEmptyCollection)
+	}
+
+	if resource == "" {
+		return fmt.Errorf("%w - unable to save record (no name)", ErrEmptyResource)
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return err
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if err := d.checkCollection(collection); err != nil {
+		return err
+	}
+
+	if _, ok := d.codecFor(collection).(JSONCodec); !ok {
+		return fmt.Errorf("%w: WriteRaw requires the JSON codec", ErrMarshal)
+	}
+
+	if d.canStream(collection) {
+		err = d.streamRecord(collection, resource, r)
+	} else {
+		err = d.bufferRecord(collection, resource, r)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return ioError(d.syncDir(d.recordDir(collection)))
+}
+
+// canStream reports whether a raw record can go to disk without being
+// buffered, see WriteRaw.
+func (d *Driver) canStream(collection string) bool {
+	if _, ok := d.fs.(fileCreator); !ok || d.singleFile {
+		return false
+	}
+
+	if d.format(collection).aead != nil || d.timestamps || d.validator != nil || d.skipIdentical {
+		return false
+	}
+
+	schema, err := d.loadSchema(collection)
+
+	return err == nil && schema == nil
+}
+
+func (d *Driver) bufferRecord(collection, resource string, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if !json.Valid(b) {
+		return fmt.Errorf("%w: '%s' in '%s' is not a single JSON value", ErrMarshal, resource, collection)
+	}
+
+	if err := d.checkRecordBytes(collection, b); err != nil {
+		return err
+	}
+
+	return d.storeRecord(collection, resource, b)
+}
+
+// streamRecord copies r to the record's temp file while validating it.
+// Unlike storeRecord it logs the write to the WAL only once the temp file
+// is complete, since its hash isn't known before; a crash before that
+// leaves a temp file for Cleanup, just like a crash mid-stage.
+func (d *Driver) streamRecord(collection, resource string, r io.Reader) error {
+	fnlPath := d.recordPath(collection, resource)
+	tmpPath := fnlPath + d.tempSuffix
+
+	if err := d.fs.MkdirAll(filepath.Join(d.dir, collection), d.dirMode); err != nil {
+		return ioError(err)
+	}
+
+	f, err := d.fs.(fileCreator).Create(tmpPath, d.fileMode)
+	if err != nil {
+		return ioError(err)
+	}
+
+	hash := sha256.New()
+
+	var w io.Writer = io.MultiWriter(f, hash)
+
+	var gz *gzip.Writer
+	if d.format(collection).compress {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+
+	lw := &limitWriter{w: w, max: d.maxRecordBytes}
+
+	err = checkJSON(json.NewDecoder(io.TeeReader(r, lw)))
+	if err == nil && gz != nil {
+		err = ioError(gz.Close())
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = ioError(cerr)
+	}
+
+	if err != nil {
+		d.fs.Remove(tmpPath)
+
+		switch {
+		case errors.Is(lw.err, ErrRecordTooLarge):
+			return fmt.Errorf("%w: more than %d bytes in '%s'", ErrRecordTooLarge, d.maxRecordBytes, collection)
+		case lw.err != nil:
+			return ioError(lw.err)
+		case errors.Is(err, ErrIO):
+			return err
+		}
+		return fmt.Errorf("%w: '%s' in '%s': %w", ErrMarshal, resource, collection, err)
+	}
+
+	id, err := d.wal.begin(walEntry{Op: walWrite, Collection: collection, Resource: resource, Hash: hex.EncodeToString(hash.Sum(nil))})
+	if err != nil {
+		d.fs.Remove(tmpPath)
+		return ioError(err)
+	}
+	defer d.wal.end(id)
+
+	if err := d.commitRecord(tmpPath, fnlPath); err != nil {
+		return ioError(err)
+	}
+
+	d.updateIndexes(collection, resource)
+	d.addToBloom(collection, resource)
+	d.publish(OpWrite, collection, resource)
+
+	return nil
+}
+
+// checkJSON consumes exactly one JSON value from dec, token by token so it
+// is never held in memory whole, and fails if anything but whitespace
+// follows it.
+func checkJSON(dec *json.Decoder) error {
+	depth := 0
+
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return errors.New("no JSON value")
+		}
+		if err != nil {
+			return err
+		}
+
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+
+		if depth == 0 {
+			break
+		}
+	}
+
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		if err != nil {
+			return err
+		}
+		return errors.New("data after the JSON value")
+	}
+
+	return nil
+}
+
+// limitWriter fails with ErrRecordTooLarge once more than max bytes, if max
+// is positive, have been written through it. err keeps the first error it
+// returned, so write failures can be told apart from bad input.
+type limitWriter struct {
+	w   io.Writer
+	n   int64
+	max int64
+	err error
+}
+
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	lw.n += int64(len(p))
+
+	if lw.max > 0 && lw.n > lw.max {
+		lw.err = ErrRecordTooLarge
+		return 0, lw.err
+	}
+
+	n, err := lw.w.Write(p)
+	if err != nil && lw.err == nil {
+		lw.err = err
+	}
+
+	return n, err
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteRawStreamsLargeDocument(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, nil)
+
+	const entries = 100000
+
+	// Feed the document through a pipe so it only ever exists in pieces,
+	// hashing what goes in.
+	pr, pw := io.Pipe()
+	sent := sha256.New()
+	w := io.MultiWriter(pw, sent)
+
+	go func() {
+		io.WriteString(w, "[")
+		for i := 0; i < entries; i++ {
+			if i > 0 {
+				io.WriteString(w, ",")
+			}
+			fmt.Fprintf(w, `{"id":%d,"name":"user-%d","company":"Aramco"}`, i, i)
+		}
+		io.WriteString(w, "]\n")
+		pw.Close()
+	}()
+
+	if err := d.WriteRaw("dumps", "users", pr); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "dumps", "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b) < 4<<20 {
+		t.Fatalf("stored record is %d bytes, want a multi-MB document", len(b))
+	}
+
+	if sum := sha256.Sum256(b); !bytes.Equal(sum[:], sent.Sum(nil)) {
+		t.Fatal("stored record differs from the streamed document")
+	}
+
+	var users []struct{ ID int }
+	if err := d.Read("dumps", "users", &users); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(users) != entries || users[entries-1].ID != entries-1 {
+		t.Fatalf("Read returned %d entries", len(users))
+	}
+}
+
+func TestWriteRawRejectsInvalidJSON(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, nil)
+
+	for _, doc := range []string{`{"Name": "Mrin`, `{"a": 1} {"b": 2}`, ``} {
+		if err := d.WriteRaw("users", "Mrinal", strings.NewReader(doc)); !errors.Is(err, ErrMarshal) {
+			t.Errorf("WriteRaw of %q = %v, want ErrMarshal", doc, err)
+		}
+	}
+
+	files, err := os.ReadDir(filepath.Join(dir, "users"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 0 {
+		t.Fatalf("rejected writes left %v", files)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trashDir holds a collection's soft-deleted records when Options.SoftDelete
+// is set. Each tombstone is named "<unix nanos>-<record file>".
+const trashDir = ".trash"
+
+// removeRecord deletes a record file, or moves it to the trash when soft
+// delete is enabled. Callers must hold the collection's write lock.
+func (d *Driver) removeRecord(collection, record string) error {
+	if !d.softDelete {
+		return d.retry.do(func() error { return d.fs.Remove(record) })
+	}
+
+	dir := filepath.Join(d.dir, collection, trashDir)
+
+	if err := d.fs.MkdirAll(dir, d.dirMode); err != nil {
+		return err
+	}
+
+	tombstone := filepath.Join(dir, strconv.FormatInt(time.Now().UnixNano(), 10)+"-"+filepath.Base(record))
+
+	return d.retry.do(func() error { return d.fs.Rename(record, tombstone) })
+}
+
+// Undelete brings back the most recently soft-deleted version of a record.
+// It fails with ErrRecordExists if the record has been written again since,
+// and with ErrRecordNotFound if there is no tombstone for it.
+//
+// It is not called Restore because that name is taken by restoring a
+// backup.
+func (d *Driver) Undelete(collection, resource string) error {
+	if collection == "" {
+		return fmt.Errorf("%w - unable to undelete", ErrEmptyCollection)
+	}
+
+	if resource == "" {
+		return fmt.Errorf("%w - unable to undelete record (no name)", ErrEmptyResource)
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return err
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	record := d.recordPath(collection, resource)
+
+	if _, err := d.fs.Stat(record); err == nil {
+		return fmt.Errorf("%w: '%s' in '%s'", ErrRecordExists, resource, collection)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	tombstones, err := d.tombstones(collection)
+	if err != nil {
+		return err
+	}
+
+	var latest string
+	var latestAt int64
+
+	for name, at := range tombstones {
+		if strings.TrimPrefix(name, strconv.FormatInt(at, 10)+"-") == filepath.Base(record) && at >= latestAt {
+			latest, latestAt = name, at
+		}
+	}
+
+	if latest == "" {
+		return fmt.Errorf("%w: '%s' in '%s' (no tombstone)", ErrRecordNotFound, resource, collection)
+	}
+
+	d.cache.remove(record)
+
+	if err := d.fs.Rename(filepath.Join(d.dir, collection, trashDir, latest), record); err != nil {
+		return err
+	}
+
+	d.updateIndexes(collection, resource)
+	d.addToBloom(collection, resource)
+	d.publish(OpWrite, collection, resource)
+
+	return d.syncDir(filepath.Dir(record))
+}
+
+// PurgeTrash permanently removes the tombstones of a collection that were
+// deleted more than olderThan ago and returns how many were removed.
+func (d *Driver) PurgeTrash(collection string, olderThan time.Duration) (int, error) {
+	if collection == "" {
+		return 0, fmt.Errorf("%w - unable to purge", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return 0, err
+	}
+
+	if d.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	tombstones, err := d.tombstones(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-olderThan).UnixNano()
+	purged := 0
+
+	for name, at := range tombstones {
+		if at >= cutoff {
+			continue
+		}
+
+		if err := d.fs.Remove(filepath.Join(d.dir, collection, trashDir, name)); err != nil && !os.IsNotExist(err) {
+			return purged, err
+		}
+
+		purged++
+	}
+
+	return purged, nil
+}
+
+// tombstones maps the file names in a collection's trash to the time, in
+// unix nanoseconds, they were deleted.
+func (d *Driver) tombstones(collection string) (map[string]int64, error) {
+	files, err := d.fs.ReadDir(filepath.Join(d.dir, collection, trashDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tombstones := make(map[string]int64, len(files))
+
+	for _, file := range files {
+		stamp, _, ok := strings.Cut(file.Name(), "-")
+		if !ok || file.IsDir() {
+			continue
+		}
+
+		at, err := strconv.ParseInt(stamp, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		tombstones[file.Name()] = at
+	}
+
+	return tombstones, nil
+}
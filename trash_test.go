@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSoftDeleteUndelete(t *testing.T) {
+	d := newTestDriver(t, &Options{SoftDelete: true})
+
+	writeSampleUsers(t, d, "users")
+
+	if err := d.Delete("users", "Mrinal"); err != nil {
+		t.Fatal(err)
+	}
+
+	var user User
+	if err := d.Read("users", "Mrinal", &user); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("Read after a soft delete = %v, want ErrRecordNotFound", err)
+	}
+
+	if n, err := d.Count("users"); err != nil || n != len(sampleUsers)-1 {
+		t.Fatalf("Count after a soft delete = %d, %v, want %d", n, err, len(sampleUsers)-1)
+	}
+
+	if err := d.Undelete("users", "Mrinal"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Read("users", "Mrinal", &user); err != nil || user != sampleUsers[0] {
+		t.Fatalf("Read after Undelete = %+v, %v, want %+v", user, err, sampleUsers[0])
+	}
+
+	if err := d.Undelete("users", "Mrinal"); !errors.Is(err, ErrRecordExists) {
+		t.Fatalf("Undelete of a live record = %v, want ErrRecordExists", err)
+	}
+
+	if err := d.Undelete("users", "Nobody"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("Undelete without a tombstone = %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	d := newTestDriver(t, &Options{SoftDelete: true})
+
+	writeSampleUsers(t, d, "users")
+
+	for _, name := range []string{"Mrinal", "Utkarsh"} {
+		if err := d.Delete("users", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := d.PurgeTrash("users", time.Hour); err != nil || n != 0 {
+		t.Fatalf("PurgeTrash of recent tombstones = %d, %v, want 0", n, err)
+	}
+
+	if n, err := d.PurgeTrash("users", 0); err != nil || n != 2 {
+		t.Fatalf("PurgeTrash = %d, %v, want 2", n, err)
+	}
+
+	if err := d.Undelete("users", "Mrinal"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("Undelete after PurgeTrash = %v, want ErrRecordNotFound", err)
+	}
+}
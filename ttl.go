@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const expirySuffix = ".ttl"
+
+// WriteWithTTL writes a record that is treated as missing once ttl has
+// elapsed. The expiry is kept in a sidecar file next to the record.
+func (d *Driver) WriteWithTTL(collection, resource string, v interface{}, ttl time.Duration) error {
+	if collection == "" {
+		return fmt.Errorf("%w - No place to save", ErrEmptyCollection)
+	}
+
+	if resource == "" {
+		return fmt.Errorf("%w - unable to save record (no name)", ErrEmptyResource)
+	}
+
+	if err := d.validateNames(collection, resource); err != nil {
+		return err
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	if d.singleFile {
+		return fmt.Errorf("WriteWithTTL is %w", errSingleFile)
+	}
+
+	mutex, err := d.getOrCreateMutex(collection)
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if err := d.writeRecord(collection, resource, v); err != nil {
+		return err
+	}
+
+	expiry := time.Now().Add(ttl).UTC().Format(time.RFC3339Nano)
+
+	return d.writeFileAtomic(d.expiryPath(d.recordPath(collection, resource)), []byte(expiry))
+}
+
+// StartExpiryReaper deletes expired records from every collection each
+// interval until the returned stop func is called.
+func (d *Driver) StartExpiryReaper(interval time.Duration) func() {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				d.reapExpired()
+			}
+		}
+	}()
+
+	var once sync.Once
+
+	stop := func() {
+		once.Do(func() { close(done) })
+	}
+
+	if !d.onClose(stop) {
+		stop()
+	}
+
+	return stop
+}
+
+func (d *Driver) reapExpired() {
+	if d.readOnly {
+		return
+	}
+
+	collections, err := d.allCollections()
+	if errors.Is(err, ErrClosed) {
+		return
+	}
+	if err != nil {
+		d.log.Error("Unable to list collections for expiry: %s", err)
+		return
+	}
+
+	for _, collection := range collections {
+		files, err := d.fs.ReadDir(filepath.Join(d.dir, collection))
+		if err != nil {
+			continue
+		}
+
+		mutex, err := d.getOrCreateMutex(collection)
+		if err != nil {
+			return
+		}
+
+		for _, file := range files {
+			if file.IsDir() || !strings.HasSuffix(file.Name(), expirySuffix) {
+				continue
+			}
+
+			resource, err := d.resourceName(strings.TrimSuffix(file.Name(), expirySuffix))
+			if err != nil {
+				continue
+			}
+
+			if err := d.expireRecord(mutex, collection, resource); err != nil && !errors.Is(err, ErrRecordNotFound) {
+				d.log.Error("Unable to expire '%s' in '%s': %s", resource, collection, err)
+			}
+		}
+	}
+}
+
+// expireRecord deletes a record under the collection's write lock if its
+// expiry has passed, returning ErrRecordNotFound when it did.
+func (d *Driver) expireRecord(mutex *collectionMutex, collection, resource string) error {
+	record := d.recordPath(collection, resource)
+
+	if !d.isExpired(record) {
+		return nil
+	}
+
+	if d.readOnly {
+		return fmt.Errorf("%w: '%s' in '%s' (expired)", ErrRecordNotFound, resource, collection)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if !d.isExpired(record) {
+		return nil
+	}
+
+	if err := d.deleteRecord(collection, resource); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%w: '%s' in '%s' (expired)", ErrRecordNotFound, resource, collection)
+}
+
+func (d *Driver) isExpired(record string) bool {
+	b, err := d.fs.ReadFile(d.expiryPath(record))
+	if err != nil {
+		return false
+	}
+
+	expiry, err := time.Parse(time.RFC3339Nano, string(b))
+	if err != nil {
+		return false
+	}
+
+	return time.Now().After(expiry)
+}
+
+// expiryPath returns the sidecar path holding the expiry of a record file.
+func (d *Driver) expiryPath(record string) string {
+	return strings.TrimSuffix(record, d.formatOf(record).extension()) + expirySuffix
+}
+
+func (d *Driver) clearExpiry(record string) error {
+	if err := d.fs.Remove(d.expiryPath(record)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
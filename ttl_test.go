@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScansSkipExpiredRecords(t *testing.T) {
+	d := newTestDriver(t, nil)
+	writeSampleUsers(t, d, "users")
+
+	if err := d.WriteWithTTL("users", "Expired", User{Name: "Expired"}, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.WriteWithTTL("users", "Fresh", User{Name: "Fresh"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	want := "Fresh,Mrinal,Prachi,Utkarsh"
+
+	records, err := d.ReadAll("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(userNames(t, records), ","); got != want {
+		t.Fatalf("ReadAll returned %s, want %s", got, want)
+	}
+
+	byName, err := d.ReadAllMap("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := byName["Expired"]; ok || len(byName) != 4 {
+		t.Fatalf("ReadAllMap returned %d records, including Expired: %t", len(byName), ok)
+	}
+
+	page, err := d.ReadPage("users", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(userNames(t, page), ","); got != want {
+		t.Fatalf("ReadPage returned %s, want %s", got, want)
+	}
+
+	matches, err := d.Query("users", func(json.RawMessage) (bool, error) { return true, nil })
+	if err != nil || len(matches) != 4 {
+		t.Fatalf("Query matched %d records, %v, want 4", len(matches), err)
+	}
+
+	globbed, err := d.ReadGlob("users", "*")
+	if _, ok := globbed["Expired"]; err != nil || ok || len(globbed) != 4 {
+		t.Fatalf("ReadGlob returned %d records, %v, including Expired: %t", len(globbed), err, ok)
+	}
+
+	if n, err := d.Count("users"); err != nil || n != 4 {
+		t.Fatalf("Count = %d, %v, want 4", n, err)
+	}
+
+	var got User
+	if err := d.Read("users", "Expired", &got); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("Read of an expired record = %v, want ErrRecordNotFound", err)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Tx stages writes and deletes across any number of collections for
+// Transaction. Nothing touches disk until the transaction commits.
+type Tx struct {
+	ops        []txOp
+	tempSuffix string
+}
+
+type txOp struct {
+	collection, resource string
+	v                    interface{}
+	delete               bool
+}
+
+// Write stages a write of v to resource in collection. A later Write or
+// Delete of the same record in the transaction replaces this one.
+func (tx *Tx) Write(collection, resource string, v interface{}) error {
+	if collection == "" {
+		return fmt.Errorf("%w - No place to save", ErrEmptyCollection)
+	}
+
+	if resource == "" {
+		return fmt.Errorf("%w - unable to save record (no name)", ErrEmptyResource)
+	}
+
+	if err := checkNames(tx.tempSuffix, collection, resource); err != nil {
+		return err
+	}
+
+	tx.ops = append(tx.ops, txOp{collection: collection, resource: resource, v: v})
+
+	return nil
+}
+
+// Delete stages a delete of resource in collection. The transaction fails
+// with ErrRecordNotFound at commit if the record does not exist by then.
+func (tx *Tx) Delete(collection, resource string) error {
+	if collection == "" {
+		return fmt.Errorf("%w - No place to delete from", ErrEmptyCollection)
+	}
+
+	if resource == "" {
+		return fmt.Errorf("%w - unable to delete record (no name)", ErrEmptyResource)
+	}
+
+	if err := checkNames(tx.tempSuffix, collection, resource); err != nil {
+		return err
+	}
+
+	tx.ops = append(tx.ops, txOp{collection: collection, resource: resource, delete: true})
+
+	return nil
+}
+
+// Transaction runs fn and then applies everything it staged on tx as a
+// unit. If fn returns an error nothing is applied.
+//
+// The commit runs in two phases with every touched collection write-locked:
+// first all writes are marshalled to temp files and all deletes are checked,
+// then the temp files are renamed into place and the deletes carried out.
+// A failure in the first phase leaves the database unchanged.
+func (d *Driver) Transaction(fn func(tx *Tx) error) error {
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	if d.singleFile {
+		return fmt.Errorf("Transaction is %w", errSingleFile)
+	}
+
+	tx := &Tx{tempSuffix: d.tempSuffix}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	ops := tx.pending()
+	if len(ops) == 0 {
+		return nil
+	}
+
+	collections := make([]string, 0, len(ops))
+	for _, op := range ops {
+		collections = append(collections, op.collection)
+	}
+
+	unlock, err := d.lockCollections(true, collections...)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	type stagedOp struct {
+		txOp
+		tmpPath, fnlPath string
+		data             []byte
+	}
+
+	staged := make([]stagedOp, 0, len(ops))
+	entries := make([]walEntry, 0, len(ops))
+
+	for _, op := range ops {
+		fnlPath := d.recordPath(op.collection, op.resource)
+
+		if op.delete {
+			if _, err := d.fs.Stat(fnlPath); err != nil {
+				if os.IsNotExist(err) {
+					return fmt.Errorf("%w: '%s' in '%s'", ErrRecordNotFound, op.resource, op.collection)
+				}
+				return err
+			}
+
+			staged = append(staged, stagedOp{txOp: op, fnlPath: fnlPath})
+			entries = append(entries, walEntry{Op: walDelete, Collection: op.collection, Resource: op.resource})
+			continue
+		}
+
+		if err := d.checkCollection(op.collection); err != nil {
+			return err
+		}
+
+		b, err := d.encodeRecord(op.collection, fnlPath, op.v)
+		if err != nil {
+			return err
+		}
+
+		staged = append(staged, stagedOp{txOp: op, fnlPath: fnlPath, data: b})
+		entries = append(entries, walEntry{Op: walWrite, Collection: op.collection, Resource: op.resource, Hash: walHash(b)})
+	}
+
+	id, err := d.wal.begin(entries...)
+	if err != nil {
+		return ioError(err)
+	}
+	defer d.wal.end(id)
+
+	for i := range staged {
+		if staged[i].delete {
+			continue
+		}
+
+		tmpPath, err := d.stageRecord(staged[i].collection, staged[i].fnlPath, staged[i].data)
+		if err != nil {
+			for _, s := range staged[:i] {
+				if s.tmpPath != "" {
+					d.fs.Remove(s.tmpPath)
+				}
+			}
+			return ioError(err)
+		}
+
+		staged[i].tmpPath = tmpPath
+	}
+
+	for _, s := range staged {
+		if s.delete {
+			d.cache.remove(s.fnlPath)
+
+			if err := d.removeRecord(s.collection, s.fnlPath); err != nil {
+				return ioError(err)
+			}
+
+			if err := d.clearExpiry(s.fnlPath); err != nil {
+				return ioError(err)
+			}
+
+			d.updateIndexes(s.collection, s.resource)
+			d.publish(OpDelete, s.collection, s.resource)
+			continue
+		}
+
+		if err := d.commitRecord(s.tmpPath, s.fnlPath); err != nil {
+			return ioError(err)
+		}
+
+		d.updateIndexes(s.collection, s.resource)
+		d.addToBloom(s.collection, s.resource)
+		d.publish(OpWrite, s.collection, s.resource)
+	}
+
+	synced := make(map[string]bool)
+	for _, s := range staged {
+		dir := filepath.Dir(s.fnlPath)
+		if synced[dir] {
+			continue
+		}
+		synced[dir] = true
+
+		if err := d.syncDir(dir); err != nil {
+			return ioError(err)
+		}
+	}
+
+	return nil
+}
+
+// pending returns the staged operations with only the last one kept for
+// each record, in the order those last operations were staged.
+func (tx *Tx) pending() []txOp {
+	last := make(map[[2]string]int, len(tx.ops))
+	for i, op := range tx.ops {
+		last[[2]string{op.collection, op.resource}] = i
+	}
+
+	ops := make([]txOp, 0, len(last))
+	for i, op := range tx.ops {
+		if last[[2]string{op.collection, op.resource}] == i {
+			ops = append(ops, op)
+		}
+	}
+
+	return ops
+}
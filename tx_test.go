@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTransactionCommits(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	err := d.Transaction(func(tx *Tx) error {
+		if err := tx.Delete("users", "Utkarsh"); err != nil {
+			return err
+		}
+
+		return tx.Write("former", "Utkarsh", sampleUsers[1])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := d.Exists("users", "Utkarsh"); ok {
+		t.Fatal("deleted record still exists after commit")
+	}
+
+	var user User
+	if err := d.Read("former", "Utkarsh", &user); err != nil || user != sampleUsers[1] {
+		t.Fatalf("written record = %+v, %v, want %+v", user, err, sampleUsers[1])
+	}
+}
+
+func TestTransactionErrorLeavesDBUnchanged(t *testing.T) {
+	errAbort := errors.New("abort")
+
+	d := newTestDriver(t, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	err := d.Transaction(func(tx *Tx) error {
+		if err := tx.Delete("users", "Mrinal"); err != nil {
+			return err
+		}
+
+		if err := tx.Write("companies", "Aramco", map[string]string{"Name": "Aramco"}); err != nil {
+			return err
+		}
+
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("Transaction = %v, want the error from fn", err)
+	}
+
+	// A failure at commit, here a delete of a missing record, must not
+	// apply the other operations either.
+	err = d.Transaction(func(tx *Tx) error {
+		if err := tx.Write("companies", "Aramco", map[string]string{"Name": "Aramco"}); err != nil {
+			return err
+		}
+
+		return tx.Delete("users", "Nobody")
+	})
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("Transaction = %v, want ErrRecordNotFound", err)
+	}
+
+	if n, err := d.Count("users"); err != nil || n != len(sampleUsers) {
+		t.Fatalf("Count of users = %d, %v, want %d", n, err, len(sampleUsers))
+	}
+
+	if _, err := d.ReadAll("companies"); !errors.Is(err, ErrCollectionNotFound) {
+		t.Fatalf("ReadAll of companies = %v, want ErrCollectionNotFound", err)
+	}
+}
+
+func TestTransactionDuringBackup(t *testing.T) {
+	// Not closed on failure: Close would wait on the deadlock too.
+	d, err := New(t.TempDir(), &Options{Logger: &testLogger{}, NoSync: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collections := []string{"accounts", "audit", "ledger", "users"}
+
+	for _, collection := range collections {
+		if err := d.Write(collection, "seed", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 200; i++ {
+			err := d.Transaction(func(tx *Tx) error {
+				for _, collection := range collections {
+					if err := tx.Write(collection, "n", i); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 200; i++ {
+			if err := d.Backup(io.Discard); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		d.Close()
+	case <-time.After(30 * time.Second):
+		t.Fatal("Transaction and Backup deadlocked")
+	}
+}
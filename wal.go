@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+const (
+	walWrite  = "write"
+	walDelete = "delete"
+	walCommit = "commit"
+)
+
+// walEntry is one line of the write-ahead log. Intents that share an ID
+// belong to the same operation, which is finished once a commit entry with
+// that ID follows them.
+type walEntry struct {
+	ID         uint64 `json:"id"`
+	Op         string `json:"op"`
+	Collection string `json:"collection,omitempty"`
+	Resource   string `json:"resource,omitempty"`
+	Hash       string `json:"hash,omitempty"`
+}
+
+// wal is an append-only intent log. A nil *wal logs nothing, so callers do
+// not need to check whether Options.WALPath was set.
+//
+// The log only grows while operations are in flight: whenever the last
+// pending operation finishes the file is truncated, so an idle log is empty.
+type wal struct {
+	mu      sync.Mutex
+	f       *os.File
+	nextID  uint64
+	pending int
+	noSync  bool
+}
+
+func openWAL(path string, mode os.FileMode, noSync bool) (*wal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wal{f: f, noSync: noSync}, nil
+}
+
+func walHash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// begin logs the intents of one operation and returns its ID. The entries
+// are synced to disk before begin returns.
+func (w *wal) begin(entries ...walEntry) (uint64, error) {
+	if w == nil {
+		return 0, nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.nextID++
+	id := w.nextID
+
+	for i := range entries {
+		entries[i].ID = id
+	}
+
+	if err := w.append(entries...); err != nil {
+		return 0, err
+	}
+
+	w.pending++
+
+	return id, nil
+}
+
+// end marks the operation as finished, whether it succeeded or not; a
+// failed operation left nothing behind to recover. Errors are ignored
+// because replaying a finished operation is harmless.
+func (w *wal) end(id uint64) {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending--
+
+	if w.pending == 0 {
+		w.truncate()
+		return
+	}
+
+	w.append(walEntry{ID: id, Op: walCommit})
+}
+
+func (w *wal) append(entries ...walEntry) error {
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.f.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	if w.noSync {
+		return nil
+	}
+
+	return w.f.Sync()
+}
+
+func (w *wal) truncate() error {
+	if err := w.f.Truncate(0); err != nil {
+		return err
+	}
+
+	if w.noSync {
+		return nil
+	}
+
+	return w.f.Sync()
+}
+
+// pendingEntries returns the intents of every operation in the log that
+// has no commit entry, in the order they were logged.
+func (w *wal) pendingEntries() ([]walEntry, error) {
+	if _, err := w.f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+
+	var entries []walEntry
+	committed := make(map[uint64]bool)
+
+	scanner := bufio.NewScanner(w.f)
+	for scanner.Scan() {
+		var e walEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// A torn final line means the crash hit begin itself, before
+			// any data file was touched.
+			break
+		}
+
+		if e.Op == walCommit {
+			committed[e.ID] = true
+			continue
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	pending := entries[:0]
+	for _, e := range entries {
+		if !committed[e.ID] {
+			pending = append(pending, e)
+		}
+	}
+
+	return pending, nil
+}
+
+func (w *wal) close() error {
+	if w == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.f.Close()
+}
+
+// replayWAL completes operations that were interrupted by a crash and then
+// empties the log. A logged write is finished by renaming its temp file into
+// place, but only when the temp file is complete, that is when its hash
+// matches the logged one; otherwise the write never happened and its temp
+// file is discarded. A logged delete is simply carried out again.
+func (d *Driver) replayWAL() error {
+	entries, err := d.wal.pendingEntries()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := d.validateNames(e.Collection, e.Resource); err != nil {
+			continue
+		}
+
+		fnlPath := d.recordPath(e.Collection, e.Resource)
+
+		switch e.Op {
+		case walWrite:
+			tmpPath := fnlPath + d.tempSuffix
+
+			b, err := d.fs.ReadFile(tmpPath)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			if walHash(b) != e.Hash {
+				d.fs.Remove(tmpPath)
+				continue
+			}
+
+			d.log.Info("Replaying write of '%s' in '%s'\n", e.Resource, e.Collection)
+
+			if err := d.commitRecord(tmpPath, fnlPath); err != nil {
+				return err
+			}
+
+		case walDelete:
+			d.log.Info("Replaying delete of '%s' in '%s'\n", e.Resource, e.Collection)
+
+			if err := d.removeRecord(e.Collection, fnlPath); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+
+			if err := d.clearExpiry(fnlPath); err != nil {
+				return err
+			}
+
+		default:
+			continue
+		}
+
+		d.updateIndexes(e.Collection, e.Resource)
+	}
+
+	return d.wal.truncate()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWALReplaysPartialBatch(t *testing.T) {
+	dir := t.TempDir()
+	walPath := filepath.Join(t.TempDir(), "wal")
+
+	d, err := New(dir, &Options{WALPath: walPath, Logger: &testLogger{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Log and stage a batch of the sample users, then commit only the first
+	// one and stop, as a crash in the middle of WriteBatch would.
+	var entries []walEntry
+	var staged [][2]string
+
+	for _, user := range sampleUsers {
+		fnlPath := d.recordPath("users", user.Name)
+
+		b, err := d.encodeRecord("users", fnlPath, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tmpPath, err := d.stageRecord("users", fnlPath, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries = append(entries, walEntry{Op: walWrite, Collection: "users", Resource: user.Name, Hash: walHash(b)})
+		staged = append(staged, [2]string{tmpPath, fnlPath})
+	}
+
+	// A write whose temp file was torn must not be replayed.
+	torn := d.recordPath("users", "Torn")
+	if err := os.WriteFile(torn+d.tempSuffix, []byte(`{"Name": "To`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entries = append(entries, walEntry{Op: walWrite, Collection: "users", Resource: "Torn", Hash: walHash([]byte(`{"Name": "Torn"}`))})
+
+	if _, err := d.wal.begin(entries...); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.commitRecord(staged[0][0], staged[0][1]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d = openTestDriver(t, dir, &Options{WALPath: walPath})
+
+	for _, want := range sampleUsers {
+		var got User
+		if err := d.Read("users", want.Name, &got); err != nil {
+			t.Fatalf("Read %s after replay: %s", want.Name, err)
+		}
+
+		if got != want {
+			t.Fatalf("replayed record = %+v, want %+v", got, want)
+		}
+	}
+
+	if ok, err := d.Exists("users", "Torn"); err != nil || ok {
+		t.Fatalf("Exists of the torn write = %v, %v, want false", ok, err)
+	}
+
+	files, err := os.ReadDir(filepath.Join(dir, "users"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		if d.isTemp(file.Name()) {
+			t.Errorf("temp file %s left after replay", file.Name())
+		}
+	}
+
+	if fi, err := os.Stat(walPath); err != nil || fi.Size() != 0 {
+		t.Fatalf("WAL after replay: %v, %v, want an empty file", fi, err)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Op int
+
+const (
+	OpWrite Op = iota + 1
+	OpDelete
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpWrite:
+		return "Write"
+	case OpDelete:
+		return "Delete"
+	default:
+		return fmt.Sprintf("Op(%d)", int(op))
+	}
+}
+
+// Event describes a change to a record.
+type Event struct {
+	Op         Op
+	Collection string
+	Resource   string
+	Time       time.Time
+}
+
+const watchBuffer = 64
+
+type watchers struct {
+	mu    sync.Mutex
+	chans map[string]map[chan Event]struct{}
+}
+
+// Watch subscribes to changes made through this Driver to a collection.
+// Events are delivered on a buffered channel; if the consumer falls behind,
+// further events are dropped rather than blocking writers. The returned func
+// unsubscribes and closes the channel.
+func (d *Driver) Watch(collection string) (<-chan Event, func(), error) {
+	if collection == "" {
+		return nil, nil, fmt.Errorf("%w - unable to watch", ErrEmptyCollection)
+	}
+
+	if err := d.validateNames(collection); err != nil {
+		return nil, nil, err
+	}
+
+	if d.closed.Load() {
+		return nil, nil, ErrClosed
+	}
+
+	ch := make(chan Event, watchBuffer)
+
+	d.watchers.mu.Lock()
+	if d.watchers.chans == nil {
+		d.watchers.chans = make(map[string]map[chan Event]struct{})
+	}
+	if d.watchers.chans[collection] == nil {
+		d.watchers.chans[collection] = make(map[chan Event]struct{})
+	}
+	d.watchers.chans[collection][ch] = struct{}{}
+	d.watchers.mu.Unlock()
+
+	var once sync.Once
+
+	cancel := func() {
+		once.Do(func() {
+			d.watchers.mu.Lock()
+			defer d.watchers.mu.Unlock()
+
+			if _, ok := d.watchers.chans[collection][ch]; !ok {
+				return
+			}
+
+			delete(d.watchers.chans[collection], ch)
+			if len(d.watchers.chans[collection]) == 0 {
+				delete(d.watchers.chans, collection)
+			}
+			close(ch)
+		})
+	}
+
+	return ch, cancel, nil
+}
+
+// closeAll closes and forgets every watcher channel.
+func (w *watchers) closeAll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, chans := range w.chans {
+		for ch := range chans {
+			close(ch)
+		}
+	}
+
+	w.chans = nil
+}
+
+func (d *Driver) publish(op Op, collection, resource string) {
+	d.watchers.mu.Lock()
+	defer d.watchers.mu.Unlock()
+
+	if len(d.watchers.chans[collection]) == 0 {
+		return
+	}
+
+	e := Event{Op: op, Collection: collection, Resource: resource, Time: time.Now()}
+
+	for ch := range d.watchers.chans[collection] {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// PollChanges detects changes to a collection's directory, including ones
+// made by other processes, by listing it every interval and comparing each
+// record file's mtime and size with the previous listing. New and modified
+// records are reported as OpWrite, vanished ones as OpDelete. Like Watch, it
+// drops events the consumer is too slow to receive.
+//
+// The returned func stops polling and closes the channel; closing the
+// Driver does the same. An invalid collection name yields a closed channel.
+func (d *Driver) PollChanges(collection string, interval time.Duration) (<-chan Event, func()) {
+	ch := make(chan Event, watchBuffer)
+
+	if err := d.validateNames(collection); err != nil || collection == "" {
+		d.log.Warn("Unable to poll '%s': %v", collection, err)
+		close(ch)
+		return ch, func() {}
+	}
+
+	done := make(chan struct{})
+	prev := d.snapshot(collection)
+
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			next := d.snapshot(collection)
+			now := time.Now()
+
+			emit := func(op Op, resource string) {
+				select {
+				case ch <- Event{Op: op, Collection: collection, Resource: resource, Time: now}:
+				default:
+				}
+			}
+
+			for resource, s := range next {
+				if old, ok := prev[resource]; !ok || old != s {
+					emit(OpWrite, resource)
+				}
+			}
+
+			for resource := range prev {
+				if _, ok := next[resource]; !ok {
+					emit(OpDelete, resource)
+				}
+			}
+
+			prev = next
+		}
+	}()
+
+	var once sync.Once
+
+	cancel := func() {
+		once.Do(func() { close(done) })
+	}
+
+	if !d.onClose(cancel) {
+		cancel()
+	}
+
+	return ch, cancel
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// snapshot returns the state of every record file in the collection. A
+// missing or unreadable directory is an empty snapshot, so records show up
+// as writes once it appears.
+func (d *Driver) snapshot(collection string) map[string]fileState {
+	states := make(map[string]fileState)
+
+	files, err := d.fs.ReadDir(filepath.Join(d.dir, collection))
+	if err != nil {
+		return states
+	}
+
+	for _, file := range files {
+		if !d.isRecordFile(collection, file) {
+			continue
+		}
+
+		resource, err := d.resourceName(strings.TrimSuffix(file.Name(), d.format(collection).extension()))
+		if err != nil {
+			continue
+		}
+
+		fi, err := file.Info()
+		if err != nil {
+			continue
+		}
+
+		states[resource] = fileState{modTime: fi.ModTime(), size: fi.Size()}
+	}
+
+	return states
+}
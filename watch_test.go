@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPollChanges(t *testing.T) {
+	dir := t.TempDir()
+	d := openTestDriver(t, dir, nil)
+
+	writeSampleUsers(t, d, "users")
+
+	events, cancel := d.PollChanges("users", 5*time.Millisecond)
+	defer cancel()
+
+	next := func() Event {
+		t.Helper()
+
+		select {
+		case e, ok := <-events:
+			if !ok {
+				t.Fatal("events closed early")
+			}
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event")
+		}
+
+		return Event{}
+	}
+
+	// Another process writes a record behind the Driver's back.
+	path := filepath.Join(dir, "users", "Someone.json")
+	if err := os.WriteFile(path, []byte(`{"Name":"Someone"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if e := next(); e.Op != OpWrite || e.Collection != "users" || e.Resource != "Someone" {
+		t.Fatalf("event = %+v, want a write of Someone", e)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if e := next(); e.Op != OpDelete || e.Resource != "Someone" {
+		t.Fatalf("event = %+v, want a delete of Someone", e)
+	}
+
+	cancel()
+
+	for range events {
+	}
+}